@@ -0,0 +1,180 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// cow publishes immutable versions of an S: readers load the current
+// version, writers clone it, apply their change and compare-and-swap
+// the result in, retrying if another writer got there first.
+type cow[S any] struct {
+	p  unsafe.Pointer // *S
+	mu sync.Mutex     // serializes batched writes
+}
+
+func (c *cow[S]) load() (s S) {
+	return ptr2val[S](atomic.LoadPointer(&c.p))
+}
+
+// update publishes fn(current), calling fn again on each retry.
+// fn must return a new S and leave current unmodified.
+func (c *cow[S]) update(fn func(cur S) S) {
+	for {
+		p := atomic.LoadPointer(&c.p)
+		s := fn(ptr2val[S](p))
+		if atomic.CompareAndSwapPointer(&c.p, p, unsafe.Pointer(&s)) {
+			return
+		}
+	}
+}
+
+// batch is like update, but batches run one at a time, so that they
+// only retry when a single write interferes.
+func (c *cow[S]) batch(fn func(cur S) S) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.update(fn)
+}
+
+// A COWSlice is a copy-on-write slice for read-mostly data.
+// Reads are a single atomic load, writes copy the whole slice.
+//
+// The zero COWSlice is empty and ready for use.
+type COWSlice[T any] struct {
+	c cow[[]T]
+}
+
+func cloneSlice[T any](s []T, extra int) []T {
+	return append(make([]T, 0, len(s)+extra), s...)
+}
+
+// Load returns the current slice, which must not be modified.
+func (s *COWSlice[T]) Load() []T {
+	return s.c.load()
+}
+
+// Len returns the length of the current slice.
+func (s *COWSlice[T]) Len() int {
+	return len(s.c.load())
+}
+
+// At returns the element at index i of the current slice.
+func (s *COWSlice[T]) At(i int) T {
+	return s.c.load()[i]
+}
+
+// Store replaces the slice with vals, which must not be modified afterwards.
+func (s *COWSlice[T]) Store(vals []T) {
+	s.c.update(func([]T) []T { return vals })
+}
+
+// Append appends vals to the slice.
+func (s *COWSlice[T]) Append(vals ...T) {
+	s.c.update(func(cur []T) []T {
+		return append(cloneSlice(cur, len(vals)), vals...)
+	})
+}
+
+// Set sets the element at index i. It panics if i is out of range.
+func (s *COWSlice[T]) Set(i int, val T) {
+	s.c.update(func(cur []T) []T {
+		next := cloneSlice(cur, 0)
+		next[i] = val
+		return next
+	})
+}
+
+// Delete removes the element at index i. It panics if i is out of range.
+func (s *COWSlice[T]) Delete(i int) {
+	s.c.update(func(cur []T) []T {
+		_ = cur[i]
+		next := make([]T, 0, len(cur)-1)
+		return append(append(next, cur[:i]...), cur[i+1:]...)
+	})
+}
+
+// Mutate publishes several changes at once. fn is called with a
+// private copy of the slice and returns the new one. Mutates run one
+// at a time, fn is called again only if a single write interferes.
+func (s *COWSlice[T]) Mutate(fn func(tx []T) []T) {
+	s.c.batch(func(cur []T) []T {
+		return fn(cloneSlice(cur, 0))
+	})
+}
+
+// A COWMap is a copy-on-write map for read-mostly data.
+// Reads are a single atomic load, writes copy the whole map.
+//
+// The zero COWMap is empty and ready for use.
+type COWMap[K comparable, V any] struct {
+	c cow[map[K]V]
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	next := make(map[K]V, len(m)+1)
+	for k, v := range m {
+		next[k] = v
+	}
+	return next
+}
+
+// Load returns the value stored for key.
+// The ok result indicates whether value was found.
+func (m *COWMap[K, V]) Load(key K) (value V, ok bool) {
+	value, ok = m.c.load()[key]
+	return value, ok
+}
+
+// Len returns the number of keys.
+func (m *COWMap[K, V]) Len() int {
+	return len(m.c.load())
+}
+
+// Range calls f for each key and value of the current map,
+// stopping if f returns false.
+func (m *COWMap[K, V]) Range(f func(key K, value V) bool) {
+	for k, v := range m.c.load() {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// Snapshot returns the current map, which must not be modified.
+func (m *COWMap[K, V]) Snapshot() map[K]V {
+	return m.c.load()
+}
+
+// Set sets the value for key.
+func (m *COWMap[K, V]) Set(key K, value V) {
+	m.c.update(func(cur map[K]V) map[K]V {
+		next := cloneMap(cur)
+		next[key] = value
+		return next
+	})
+}
+
+// Delete deletes the value for key.
+func (m *COWMap[K, V]) Delete(key K) {
+	m.c.update(func(cur map[K]V) map[K]V {
+		if _, ok := cur[key]; !ok {
+			return cur
+		}
+		next := cloneMap(cur)
+		delete(next, key)
+		return next
+	})
+}
+
+// Mutate publishes several changes at once. fn is called with a
+// private copy of the map to modify. Mutates run one at a time, fn is
+// called again only if a single write interferes.
+func (m *COWMap[K, V]) Mutate(fn func(tx map[K]V)) {
+	m.c.batch(func(cur map[K]V) map[K]V {
+		next := cloneMap(cur)
+		fn(next)
+		return next
+	})
+}
@@ -0,0 +1,101 @@
+package store_test
+
+import (
+	"store"
+	"sync"
+	"testing"
+)
+
+func TestCOWSlice(t *testing.T) {
+	var s store.COWSlice[int]
+	if s.Len() != 0 || s.Load() != nil {
+		t.Fatal("initial COWSlice is not empty")
+	}
+	s.Append(1, 2, 3)
+	old := s.Load()
+	s.Set(0, 10)
+	s.Delete(1)
+	if got := s.Load(); len(got) != 2 || got[0] != 10 || got[1] != 3 {
+		t.Fatal(fmtfn("load", got, []int{10, 3}))
+	}
+	if old[0] != 1 || len(old) != 3 {
+		t.Fatal(fmtfn("old version modified", old, []int{1, 2, 3}))
+	}
+	s.Mutate(func(tx []int) []int {
+		tx[0] = 0
+		return append(tx, 4, 5)
+	})
+	if got := s.Load(); len(got) != 4 || got[0] != 0 || s.At(3) != 5 {
+		t.Fatal(fmtfn("load after Mutate", got, []int{0, 3, 4, 5}))
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Set out of range should panic")
+			}
+		}()
+		s.Set(4, 0)
+	}()
+}
+
+func TestCOWMap(t *testing.T) {
+	var m store.COWMap[string, int]
+	if _, ok := m.Load("foo"); ok || m.Len() != 0 {
+		t.Fatal("initial COWMap is not empty")
+	}
+	m.Set("foo", 1)
+	snap := m.Snapshot()
+	m.Set("bar", 2)
+	m.Delete("foo")
+	m.Delete("baz")
+	if v, ok := m.Load("bar"); v != 2 || !ok || m.Len() != 1 {
+		t.Fatalf("Load: got %v %v len %d, want 2 true len 1", v, ok, m.Len())
+	}
+	if len(snap) != 1 || snap["foo"] != 1 {
+		t.Fatal(fmtfn("old version modified", snap, map[string]int{"foo": 1}))
+	}
+	m.Mutate(func(tx map[string]int) {
+		tx["a"], tx["b"] = 1, 2
+		delete(tx, "bar")
+	})
+	sum := 0
+	m.Range(func(k string, v int) bool {
+		sum += v
+		return true
+	})
+	if sum != 3 || m.Len() != 2 {
+		t.Fatalf("Range: got sum %d len %d, want 3 2", sum, m.Len())
+	}
+}
+
+func TestCOWConcurrent(t *testing.T) {
+	var s store.COWSlice[int]
+	var m store.COWMap[int, int]
+	var w sync.WaitGroup
+	p, n := 8, 100
+	if testing.Short() {
+		n = 10
+	}
+	for i := 0; i < p; i++ {
+		i := i
+		w.Add(1)
+		go func() {
+			for j := 0; j < n; j++ {
+				if j%2 == 0 {
+					s.Append(1)
+					m.Set(i*n+j, 1)
+				} else {
+					s.Mutate(func(tx []int) []int { return append(tx, 1) })
+					m.Mutate(func(tx map[int]int) { tx[i*n+j] = 1 })
+				}
+				_ = s.Load()
+				m.Load(j)
+			}
+			w.Done()
+		}()
+	}
+	w.Wait()
+	if s.Len() != p*n || m.Len() != p*n {
+		t.Errorf("got len %d and %d, want %d", s.Len(), m.Len(), p*n)
+	}
+}
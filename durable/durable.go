@@ -0,0 +1,309 @@
+// Package durable provides a Value that survives restarts by
+// persisting every write to a file.
+//
+// A write encodes the new value with a Codec, writes it to a
+// temporary file next to the target, syncs it and renames it over the
+// target, so that the file always holds either the old or the new
+// value in full. A CRC guards the contents against corruption.
+package durable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"store"
+	"sync"
+)
+
+// ErrCorrupt is returned by Open when the file fails its CRC check
+// or is truncated.
+var ErrCorrupt = errors.New("durable: corrupt file")
+
+// A SyncError is returned by a write that took effect, in memory and in
+// the file, but whose directory could not be synced: a crash may still
+// undo it.
+type SyncError struct {
+	Err error
+}
+
+func (e *SyncError) Error() string {
+	return "durable: write not synced: " + e.Err.Error()
+}
+
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// A Codec encodes values to bytes and back. Values of mixed types go
+// through the type registry of store.RegisterType.
+type Codec interface {
+	Marshal(val any) ([]byte, error)
+	Unmarshal(data []byte) (val any, err error)
+}
+
+var (
+	// JSON encodes values as store.Entry does with encoding/json.
+	JSON Codec = entryCodec{
+		marshal:   func(e *store.Entry) ([]byte, error) { return json.Marshal(e) },
+		unmarshal: func(e *store.Entry, data []byte) error { return json.Unmarshal(data, e) },
+	}
+
+	// Gob encodes values as store.Entry does with encoding/gob.
+	Gob Codec = entryCodec{
+		marshal:   (*store.Entry).GobEncode,
+		unmarshal: (*store.Entry).GobDecode,
+	}
+)
+
+type entryCodec struct {
+	marshal   func(e *store.Entry) ([]byte, error)
+	unmarshal func(e *store.Entry, data []byte) error
+}
+
+func (c entryCodec) Marshal(val any) ([]byte, error) {
+	var e store.Entry
+	e.Store(val)
+	return c.marshal(&e)
+}
+
+func (c entryCodec) Unmarshal(data []byte) (any, error) {
+	var e store.Entry
+	err := c.unmarshal(&e, data)
+	return e.Load(), err
+}
+
+// A Value is a store.Value persisted to a file. Load is lock-free and
+// never touches the file, writes are serialized and return once the
+// new value is on disk. A write that fails before the file is replaced
+// leaves the value unchanged. Once the file is replaced the write took
+// effect, as it would be read back after a restart: if syncing the
+// directory then fails, it returns its results with a SyncError.
+//
+// Every value of a Value must be of the same concrete type, as with
+// store.Value, until Reset. A nil is persisted along with the last
+// value stored before it, so that the type holds across restarts.
+type Value struct {
+	path  string
+	codec Codec
+	v     store.Value
+	mu    sync.Mutex   // serializes writes, guards the fields below
+	typ   reflect.Type // of the values stored
+	last  []byte       // encoding of the last value of type typ
+}
+
+// Open returns the Value persisted at path, loading its last value if
+// the file exists. It returns ErrCorrupt if the file is damaged.
+func Open(path string, codec Codec) (*Value, error) {
+	v := &Value{path: path, codec: codec}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decodeFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 || payload[0] > fileNil {
+		return nil, ErrCorrupt
+	}
+	if last := payload[1:]; len(last) > 0 {
+		val, err := codec.Unmarshal(last)
+		if err != nil {
+			return nil, err
+		}
+		v.v.Store(val)
+		v.typ, v.last = reflect.TypeOf(val), last
+	}
+	if payload[0] == fileNil {
+		v.v.Store(nil)
+	}
+	return v, nil
+}
+
+// The payload of the file is its kind, then the encoded value for a
+// fileValue, or the last value of the same type, if any, for a fileNil.
+const (
+	fileValue byte = iota
+	fileNil
+)
+
+// Load returns the value set by the most recent write.
+func (v *Value) Load() (val any) {
+	return v.v.Load()
+}
+
+// LoadOk is like Load but also reports whether a value has been
+// stored, and not Reset since.
+func (v *Value) LoadOk() (val any, ok bool) {
+	return v.v.LoadOk()
+}
+
+// Store persists val and then sets the value to it.
+func (v *Value) Store(val any) error {
+	_, err := v.Swap(val)
+	return err
+}
+
+// Swap persists new, sets the value to it and returns the previous one.
+func (v *Value) Swap(new any) (old any, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.write(new); !done(err) {
+		return nil, err
+	}
+	return v.v.Swap(new), err
+}
+
+// CompareAndSwap persists new and sets the value to it if the value
+// is equal to old. It returns store.ErrUncomparable for values of an
+// uncomparable type.
+func (v *Value) CompareAndSwap(old, new any) (swapped bool, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if eq, err := equal(v.v.Load(), old); !eq {
+		return false, err
+	}
+	if err := v.write(new); !done(err) {
+		return false, err
+	}
+	v.v.Store(new)
+	return true, err
+}
+
+// Reset removes the file and returns the Value to the state where
+// nothing has been stored.
+func (v *Value) Reset() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := os.Remove(v.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	v.v.Reset()
+	v.typ, v.last = nil, nil
+	if err := syncDir(filepath.Dir(v.path)); err != nil {
+		return &SyncError{err}
+	}
+	return nil
+}
+
+// write persists val, which the caller then stores, holding mu. Once
+// the file is replaced, it only fails with a SyncError.
+func (v *Value) write(val any) error {
+	typ := reflect.TypeOf(val)
+	if typ != nil && v.typ != nil && typ != v.typ {
+		return store.ErrInconsistentType
+	}
+	var payload []byte
+	if val == nil {
+		payload = append([]byte{fileNil}, v.last...)
+	} else {
+		data, err := v.codec.Marshal(val)
+		if err != nil {
+			return err
+		}
+		payload = append([]byte{fileValue}, data...)
+	}
+	if err := replaceFile(v.path, encodeFile(payload)); err != nil {
+		return err
+	}
+	if val != nil {
+		v.typ, v.last = typ, payload[1:]
+	}
+	if err := syncDir(filepath.Dir(v.path)); err != nil {
+		return &SyncError{err}
+	}
+	return nil
+}
+
+// done reports whether err, returned by write, leaves the write done.
+func done(err error) bool {
+	var s *SyncError
+	return err == nil || errors.As(err, &s)
+}
+
+// equal reports whether x == y, returning store.ErrUncomparable
+// instead of panicking for uncomparable types.
+func equal(x, y any) (eq bool, err error) {
+	defer func() {
+		if recover() != nil {
+			eq, err = false, store.ErrUncomparable
+		}
+	}()
+	return x == y, nil
+}
+
+// The file holds a magic number, the CRC-32C of the payload, the
+// length of the payload and the payload itself.
+var magic = []byte("stv1")
+
+const headerSize = 4 + 4 + 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func encodeFile(payload []byte) []byte {
+	buf := make([]byte, headerSize, headerSize+len(payload))
+	copy(buf, magic)
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(payload, crcTable))
+	binary.BigEndian.PutUint64(buf[8:], uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+func decodeFile(data []byte) ([]byte, error) {
+	if len(data) < headerSize || !bytes.Equal(data[:4], magic) {
+		return nil, ErrCorrupt
+	}
+	payload := data[headerSize:]
+	if binary.BigEndian.Uint64(data[8:]) != uint64(len(payload)) ||
+		binary.BigEndian.Uint32(data[4:]) != crc32.Checksum(payload, crcTable) {
+		return nil, ErrCorrupt
+	}
+	return payload, nil
+}
+
+// replaceFile atomically replaces path with data. The replacement is
+// durable once the directory is synced.
+func replaceFile(path string, data []byte) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// syncDir makes a rename or removal in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
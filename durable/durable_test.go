@@ -0,0 +1,151 @@
+package durable_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"store"
+	"store/durable"
+	"testing"
+)
+
+type settings struct {
+	Level int
+	Tags  []string
+}
+
+func init() {
+	store.RegisterType("durable_test.settings", &settings{})
+}
+
+func TestValue(t *testing.T) {
+	for name, codec := range map[string]durable.Codec{"json": durable.JSON, "gob": durable.Gob} {
+		path := filepath.Join(t.TempDir(), "v")
+		v, err := durable.Open(path, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x, ok := v.LoadOk(); x != nil || ok {
+			t.Fatalf("%s: new Value holds %v %v", name, x, ok)
+		}
+		a, b := &settings{1, []string{"a"}}, &settings{Level: 2}
+		if err := v.Store(a); err != nil {
+			t.Fatal(err)
+		}
+		if old, err := v.Swap(b); old != a || err != nil {
+			t.Fatalf("%s Swap: got %v %v, want %v nil", name, old, err, a)
+		}
+		if ok, err := v.CompareAndSwap(a, a); ok || err != nil {
+			t.Fatalf("%s CompareAndSwap of stale value: got %v %v", name, ok, err)
+		}
+		if ok, err := v.CompareAndSwap(b, b); !ok || err != nil {
+			t.Fatalf("%s CompareAndSwap: got %v %v, want true nil", name, ok, err)
+		}
+		if err := v.Store(1); !errors.Is(err, store.ErrInconsistentType) {
+			t.Fatalf("%s inconsistent Store: got %v, want %v", name, err, store.ErrInconsistentType)
+		}
+
+		v, err = durable.Open(path, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := v.Load().(*settings)
+		if got == nil || got.Level != 2 || got.Tags != nil {
+			t.Fatalf("%s reopen: got %+v, want %+v", name, got, b)
+		}
+		if err := v.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if v, err = durable.Open(path, codec); err != nil || v.Load() != nil {
+			t.Fatalf("%s reopen after Reset: got %v %v", name, v.Load(), err)
+		}
+		if err := v.Store(3); err != nil {
+			t.Fatalf("%s Store of a new type after Reset: %v", name, err)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 1 {
+			t.Fatalf("%s: temporary files left: %v", name, entries)
+		}
+	}
+}
+
+func TestNil(t *testing.T) {
+	for name, codec := range map[string]durable.Codec{"json": durable.JSON, "gob": durable.Gob} {
+		path := filepath.Join(t.TempDir(), "v")
+		v, _ := durable.Open(path, codec)
+		if err := v.Store(nil); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ = durable.Open(path, codec); !isNil(v) {
+			t.Fatalf("%s reopen after a first Store(nil): got %v", name, v.Load())
+		}
+		// The first nil does not fix the type, a stored value does.
+		if err := v.Store(&settings{Level: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Store(nil); err != nil {
+			t.Fatal(err)
+		}
+		v, err := durable.Open(path, codec)
+		if err != nil || !isNil(v) {
+			t.Fatalf("%s reopen after Store(nil): got %v %v", name, v.Load(), err)
+		}
+		if err := v.Store(1); !errors.Is(err, store.ErrInconsistentType) {
+			t.Fatalf("%s Store of another type after reopen: got %v, want %v", name, err, store.ErrInconsistentType)
+		}
+		if err := v.Store(&settings{Level: 2}); err != nil {
+			t.Fatalf("%s Store after reopen: %v", name, err)
+		}
+	}
+}
+
+// isNil reports whether v holds a stored nil.
+func isNil(v *durable.Value) bool {
+	x, ok := v.LoadOk()
+	return x == nil && ok
+}
+
+func TestCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v")
+	v, _ := durable.Open(path, durable.JSON)
+	if err := v.Store("precious"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, bad := range map[string][]byte{
+		"flipped":   append(append([]byte(nil), data[:len(data)-2]...), data[len(data)-2]^1, data[len(data)-1]),
+		"truncated": data[:len(data)-1],
+		"header":    data[:5],
+		"empty":     nil,
+	} {
+		if err := os.WriteFile(path, bad, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := durable.Open(path, durable.JSON); !errors.Is(err, durable.ErrCorrupt) {
+			t.Errorf("%s: got %v, want %v", name, err, durable.ErrCorrupt)
+		}
+	}
+}
+
+func TestWriteFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "gone")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := durable.Open(filepath.Join(dir, "v"), durable.JSON)
+	if err := v.Store("kept"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Store("lost"); err == nil {
+		t.Fatal("Store into a removed directory should fail")
+	}
+	if x := v.Load(); x != "kept" {
+		t.Fatalf("failed Store changed the value to %v", x)
+	}
+}
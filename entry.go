@@ -9,6 +9,7 @@ import (
 // The zero value for a Entry returns nil from Load.
 type Entry struct {
 	p unsafe.Pointer
+	w unsafe.Pointer // *waiters, set by the first WaitFor or Tx.Retry
 }
 
 func ptr2any(p unsafe.Pointer) any {
@@ -20,30 +21,130 @@ func ptr2any(p unsafe.Pointer) any {
 
 // Ptr returns entry pointer
 func (e *Entry) Ptr() (p unsafe.Pointer) {
-	return e.p
+	return e.load()
+}
+
+// load returns the pointer to the current value, first helping any
+// CompareAndSwapN that holds e to finish.
+func (e *Entry) load() unsafe.Pointer {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		r := asRef(p)
+		if r == nil {
+			return p
+		}
+		r.resolve(e, p)
+	}
 }
 
 // Load returns the value set by the most recent Store.
 func (e *Entry) Load() (val any) {
-	return ptr2any(atomic.LoadPointer(&e.p))
+	return ptr2any(e.load())
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// nil, has been stored since the Entry was created or Reset.
+func (e *Entry) LoadOk() (val any, ok bool) {
+	p := e.load()
+	return ptr2any(p), p != nil
+}
+
+// Reset returns the Entry to the state where nothing has been stored.
+func (e *Entry) Reset() {
+	e.swap(nil)
 }
 
 // Store sets the value of the Value to x.
 func (e *Entry) Store(val any) {
-	atomic.StorePointer(&e.p, unsafe.Pointer(&val))
+	e.swap(unsafe.Pointer(&val))
 }
 
 // Swap stores new into Value and returns the previous value.
 // It returns nil if the Value is empty.
 func (e *Entry) Swap(new any) (old any) {
-	return ptr2any(atomic.SwapPointer(&e.p, unsafe.Pointer(&new)))
+	return ptr2any(e.swap(unsafe.Pointer(&new)))
+}
+
+// SwapPtr stores new and returns the pointer to the previous value,
+// as Ptr returned it, nil if the Entry was empty.
+func (e *Entry) SwapPtr(new any) (old unsafe.Pointer) {
+	return e.swap(unsafe.Pointer(&new))
+}
+
+// swap replaces the value pointer with p. It cannot blindly swap,
+// that could overwrite a CompareAndSwapN in progress.
+func (e *Entry) swap(p unsafe.Pointer) (old unsafe.Pointer) {
+	for {
+		old = e.load()
+		if atomic.CompareAndSwapPointer(&e.p, old, p) {
+			wake(&e.w)
+			return old
+		}
+	}
 }
 
 // CompareAndSwap executes the compare-and-swap operation for the Value.
+// CompareAndSwap of an uncomparable value panics with ErrUncomparable.
 func (e *Entry) CompareAndSwap(old, new any) (swapped bool) {
-	p := atomic.LoadPointer(&e.p)
-	if ptr2any(p) != old {
-		return false
+	swapped, err := e.TryCompareAndSwap(old, new)
+	if err != nil {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwap is like CompareAndSwap but returns ErrUncomparable
+// instead of panicking.
+func (e *Entry) TryCompareAndSwap(old, new any) (swapped bool, err error) {
+	p := e.load()
+	if eq, err := equal(ptr2any(p), old); !eq {
+		return false, err
+	}
+	if !atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&new)) {
+		return false, nil
+	}
+	wake(&e.w)
+	return true, nil
+}
+
+// CompareAndSwapPtr stores new if the pointer to the current value,
+// as Ptr returns it, is old. Unlike CompareAndSwap, it tells apart
+// equal values stored by different writes.
+func (e *Entry) CompareAndSwapPtr(old unsafe.Pointer, new any) (swapped bool) {
+	for {
+		// The value is old if the pointer is, once any CompareAndSwapN
+		// holding e is out of the way.
+		if e.load() != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, old, unsafe.Pointer(&new)) {
+			wake(&e.w)
+			return true
+		}
+	}
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns, retrying with the fresh value
+// whenever another writer got there first.
+//
+// It returns the stored value and true, or the last value fn was
+// called with and false if fn declined. Use Retry to back off or
+// bound the number of attempts.
+func (e *Entry) Update(fn func(old any) (new any, ok bool)) (new any, updated bool) {
+	return Retry{}.Update(e, fn)
+}
+
+func (e *Entry) tryUpdate(fn func(old any) (new any, ok bool)) (val any, updated, done bool) {
+	p := e.load()
+	old := ptr2any(p)
+	new, ok := fn(old)
+	if !ok {
+		return old, false, true
+	}
+	if !atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&new)) {
+		return old, false, false
 	}
-	return atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&new))
+	wake(&e.w)
+	return new, true, true
 }
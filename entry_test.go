@@ -4,6 +4,7 @@ package store_test
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 import (
+	"errors"
 	"math/rand"
 	"runtime"
 	"store"
@@ -24,6 +25,24 @@ func TestPtr(t *testing.T) {
 	}
 }
 
+func TestSwapPtr(t *testing.T) {
+	var e store.Entry
+	if p := e.SwapPtr(1); p != nil {
+		t.Fatalf("SwapPtr of empty Entry: got %v, want nil", p)
+	}
+	p := e.Ptr()
+	if old := e.SwapPtr(1); old != p {
+		t.Fatalf("SwapPtr: got %v, want %v", old, p)
+	}
+	// The value is still 1, but stored by another write.
+	if e.CompareAndSwapPtr(p, 2) {
+		t.Fatal("CompareAndSwapPtr of a replaced pointer to an equal value succeeded")
+	}
+	if !e.CompareAndSwapPtr(e.Ptr(), 2) || e.Load() != 2 {
+		t.Fatalf("CompareAndSwapPtr of the current pointer: got %v, want 2", e.Load())
+	}
+}
+
 func TestInit(t *testing.T) {
 	newFactor(func(name string, v iface) {
 		if v.Load() != nil {
@@ -236,3 +255,46 @@ func TestCompareAndSwapConcurrent(t *testing.T) {
 		}
 	})
 }
+
+func TestCompareAndSwapUncomparable(t *testing.T) {
+	newFactor(func(name string, v iface) {
+		v.Store(map[int]int{})
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, store.ErrUncomparable) {
+					t.Errorf("%s uncomparable panic: got '%v', want '%v'", name, err, store.ErrUncomparable)
+				}
+			}()
+			v.CompareAndSwap(map[int]int{}, 1)
+		}()
+	})
+	var e store.Entry
+	e.Store([]int{1})
+	if ok, err := e.TryCompareAndSwap([]int{1}, 2); ok || !errors.Is(err, store.ErrUncomparable) {
+		t.Fatalf("TryCompareAndSwap: got %v %v, want false %v", ok, err, store.ErrUncomparable)
+	}
+	if ok, err := e.TryCompareAndSwap(1, 2); ok || err != nil {
+		t.Fatalf("TryCompareAndSwap: got %v %v, want false nil", ok, err)
+	}
+}
+
+func TestLoadOkReset(t *testing.T) {
+	newFactor(func(name string, v iface) {
+		if x, ok := v.LoadOk(); x != nil || ok {
+			t.Fatalf("%s initial LoadOk: got %v %v, want nil false", name, x, ok)
+		}
+		v.Store(nil)
+		if x, ok := v.LoadOk(); x != nil || !ok {
+			t.Fatalf("%s LoadOk after Store(nil): got %v %v, want nil true", name, x, ok)
+		}
+		v.Store(1)
+		v.Reset()
+		if x, ok := v.LoadOk(); x != nil || ok {
+			t.Fatalf("%s LoadOk after Reset: got %v %v, want nil false", name, x, ok)
+		}
+		if x := v.Load(); x != nil {
+			t.Fatal(fmtfn(name+" load after Reset", x, nil))
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// An Expiring holds a value together with the deadline after which
+// it is stale, such as a token or a DNS result.
+//
+// With Refresh set, Load starts refreshing the value in the background
+// once it is about to expire, at most one refresh at a time, and keeps
+// returning the last good value meanwhile, stale-while-revalidate.
+//
+// The zero Expiring is empty and ready for use.
+// An Expiring must not be copied after first use.
+type Expiring struct {
+	// TTL is how long a stored value stays fresh.
+	TTL time.Duration
+
+	// Refresh, if set, loads a new value. A ttl of 0 means TTL.
+	Refresh func() (val any, ttl time.Duration, err error)
+
+	// RefreshAhead is how long before its deadline a value is
+	// refreshed, 0 means once it is stale.
+	RefreshAhead time.Duration
+
+	// MaxStale is how long after its deadline a value is still
+	// returned, as stale, 0 means without limit.
+	MaxStale time.Duration
+
+	// RetryAfter is how long to wait after a failed refresh before
+	// trying again, 0 means on the next Load.
+	RetryAfter time.Duration
+
+	v          Value // *expiringValue
+	failure    Value // *expiringFailure of the last refresh
+	refreshing int32
+}
+
+type expiringValue struct {
+	val      any
+	deadline time.Time
+}
+
+type expiringFailure struct {
+	err error
+	at  time.Time
+}
+
+// Load returns the current value and whether it is still fresh.
+// A value stale for longer than MaxStale is not returned.
+func (e *Expiring) Load() (val any, fresh bool) {
+	now := time.Now()
+	x, _ := e.v.Load().(*expiringValue)
+	if e.Refresh != nil && (x == nil || !now.Before(x.deadline.Add(-e.RefreshAhead))) {
+		e.startRefresh(now)
+	}
+	switch {
+	case x == nil:
+		return nil, false
+	case now.Before(x.deadline):
+		return x.val, true
+	case e.MaxStale > 0 && now.After(x.deadline.Add(e.MaxStale)):
+		return nil, false
+	}
+	return x.val, false
+}
+
+// Deadline returns the time the current value goes stale,
+// the zero time if there is none.
+func (e *Expiring) Deadline() time.Time {
+	if x, _ := e.v.Load().(*expiringValue); x != nil {
+		return x.deadline
+	}
+	return time.Time{}
+}
+
+// Store sets the value to val, fresh for TTL.
+func (e *Expiring) Store(val any) {
+	e.StoreUntil(val, time.Now().Add(e.TTL))
+}
+
+// StoreUntil sets the value to val, fresh until deadline.
+func (e *Expiring) StoreUntil(val any, deadline time.Time) {
+	e.v.Store(&expiringValue{val: val, deadline: deadline})
+}
+
+// Err returns the error of the last refresh, nil if it succeeded.
+func (e *Expiring) Err() error {
+	if f, _ := e.failure.Load().(*expiringFailure); f != nil {
+		return f.err
+	}
+	return nil
+}
+
+// startRefresh runs Refresh in the background,
+// unless it is already running or failed too recently.
+func (e *Expiring) startRefresh(now time.Time) {
+	if f, _ := e.failure.Load().(*expiringFailure); f != nil && f.err != nil && now.Before(f.at.Add(e.RetryAfter)) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&e.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&e.refreshing, 0)
+		val, ttl, err := e.Refresh()
+		now := time.Now()
+		e.failure.Store(&expiringFailure{err: err, at: now})
+		if err != nil {
+			return
+		}
+		if ttl == 0 {
+			ttl = e.TTL
+		}
+		e.StoreUntil(val, now.Add(ttl))
+	}()
+}
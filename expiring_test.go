@@ -0,0 +1,119 @@
+package store_test
+
+import (
+	"errors"
+	"store"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpiring(t *testing.T) {
+	e := &store.Expiring{TTL: time.Hour, MaxStale: time.Hour}
+	if v, fresh := e.Load(); v != nil || fresh {
+		t.Fatalf("Load on empty: got %v %v, want nil false", v, fresh)
+	}
+	e.Store("token")
+	if v, fresh := e.Load(); v != "token" || !fresh {
+		t.Fatalf("Load: got %v %v, want token true", v, fresh)
+	}
+	if d := time.Until(e.Deadline()); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("stored value expires in %v, want TTL", d)
+	}
+	e.StoreUntil("token", time.Now().Add(-time.Minute))
+	if v, fresh := e.Load(); v != "token" || fresh {
+		t.Fatalf("Load when stale: got %v %v, want token false", v, fresh)
+	}
+	e.StoreUntil("token", time.Now().Add(-2*time.Hour))
+	if v, fresh := e.Load(); v != nil || fresh {
+		t.Fatalf("Load past MaxStale: got %v %v, want nil false", v, fresh)
+	}
+	deadline := time.Now().Add(time.Hour)
+	e.StoreUntil("long", deadline)
+	if d := e.Deadline(); !d.Equal(deadline) {
+		t.Fatal(fmtfn("deadline", d, deadline))
+	}
+}
+
+// waitFresh polls e until it holds want, fresh.
+func waitFresh(t *testing.T, e *store.Expiring, want any) {
+	t.Helper()
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(time.Millisecond) {
+		if v, fresh := e.Load(); v == want && fresh {
+			return
+		}
+	}
+	t.Fatalf("value never became %v", want)
+}
+
+func TestExpiringRefresh(t *testing.T) {
+	var calls int32
+	release := make(chan struct{}, 10)
+	e := &store.Expiring{
+		TTL:          time.Hour,
+		RefreshAhead: 30 * time.Minute,
+		Refresh: func() (any, time.Duration, error) {
+			<-release
+			return int(atomic.AddInt32(&calls, 1)), 0, nil
+		},
+	}
+	// Concurrent Loads share one refresh, which cannot finish before
+	// they all returned.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, fresh := e.Load(); v != nil || fresh {
+				t.Errorf("Load before first refresh: got %v %v", v, fresh)
+			}
+		}()
+	}
+	wg.Wait()
+	release <- struct{}{}
+	waitFresh(t, e, 1)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal(fmtfn("refreshes", n, 1))
+	}
+
+	// A value about to expire is refreshed ahead, and served meanwhile.
+	e.StoreUntil(1, time.Now().Add(time.Minute))
+	if v, fresh := e.Load(); v != 1 || !fresh {
+		t.Fatalf("Load while refreshing: got %v %v, want 1 true", v, fresh)
+	}
+	release <- struct{}{}
+	waitFresh(t, e, 2)
+	if d := time.Until(e.Deadline()); d < 59*time.Minute {
+		t.Fatalf("refreshed value expires in %v, want TTL", d)
+	}
+}
+
+func TestExpiringRefreshError(t *testing.T) {
+	errDown := errors.New("down")
+	var calls int32
+	e := &store.Expiring{
+		RetryAfter: time.Hour,
+		Refresh: func() (any, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, 0, errDown
+		},
+	}
+	e.StoreUntil("last good", time.Now().Add(-time.Millisecond))
+	for end := time.Now().Add(5 * time.Second); e.Err() == nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(end) {
+			t.Fatal("refresh never failed")
+		}
+		if v, fresh := e.Load(); v != "last good" || fresh {
+			t.Fatalf("Load while failing: got %v %v, want last good false", v, fresh)
+		}
+	}
+	if e.Err() != errDown {
+		t.Fatal(fmtfn("Err", e.Err(), errDown))
+	}
+	e.Load()
+	time.Sleep(5 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal(fmtfn("refreshes within RetryAfter", n, 1))
+	}
+}
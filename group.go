@@ -0,0 +1,162 @@
+package store
+
+import "sync"
+
+// A Group owns a set of Values and publishes them together: a
+// Snapshot sees every member as of the same Commit, never a mix of
+// older and newer values.
+//
+// Commits also store into the member Values they change, so that their
+// own Load keeps working, one value at a time. Writes made directly to
+// a member are not seen by the Group, and are overwritten by the next
+// Commit that changes it.
+type Group struct {
+	index map[*Value]int // member to its slot in a groupState
+	state cow[groupState]
+	mu    sync.Mutex // serializes commits
+}
+
+// groupState is an immutable version of the members' values.
+type groupState struct {
+	version uint64
+	vals    []any
+}
+
+// NewGroup returns a Group owning vs, starting from their
+// current values.
+func NewGroup(vs ...*Value) *Group {
+	g := &Group{index: make(map[*Value]int, len(vs))}
+	vals := make([]any, 0, len(vs))
+	for _, v := range vs {
+		if _, ok := g.index[v]; ok {
+			continue
+		}
+		g.index[v] = len(vals)
+		vals = append(vals, v.Load())
+	}
+	g.state.update(func(groupState) groupState {
+		return groupState{vals: vals}
+	})
+	return g
+}
+
+func (g *Group) slot(v *Value) int {
+	i, ok := g.index[v]
+	if !ok {
+		panic("store: Value is not a member of the Group")
+	}
+	return i
+}
+
+// Snapshot returns the values of the members as of the last Commit.
+// It takes a single atomic load.
+func (g *Group) Snapshot() Snapshot {
+	return Snapshot{g: g, s: g.state.load()}
+}
+
+// Commit calls fn with a Writer and then publishes all the values fn
+// stored through it at once. Commits run one at a time, fn is called
+// exactly once.
+//
+// Nothing is published if fn panics. Nor is it if a member fn changed
+// was written directly with a value of another type than the one it
+// gets: Commit then returns ErrInconsistentType, after putting back the
+// members it had already stored into.
+func (g *Group) Commit(fn func(w *Writer)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cur := g.state.load()
+	w := &Writer{g: g, vals: append([]any(nil), cur.vals...), changed: make([]bool, len(cur.vals))}
+	fn(w)
+	if !w.dirty {
+		return nil
+	}
+	// Store the members before publishing, so that a failed store
+	// leaves the snapshot as it was.
+	var stored []groupUndo
+	for v, i := range g.index {
+		if !w.changed[i] {
+			continue
+		}
+		prev, ok := v.LoadOk()
+		u := groupUndo{v: v, prev: prev, ok: ok, typed: v.loadType() != nil}
+		if err := v.TryStore(w.vals[i]); err != nil {
+			for _, u := range stored {
+				u.restore()
+			}
+			return err
+		}
+		stored = append(stored, u)
+	}
+	next := groupState{version: cur.version + 1, vals: w.vals}
+	g.state.update(func(groupState) groupState { return next })
+	return nil
+}
+
+// groupUndo is what a member held before a Commit stored into it.
+type groupUndo struct {
+	v         *Value
+	prev      any
+	ok, typed bool // LoadOk of prev, and whether v had a concrete type
+}
+
+func (u groupUndo) restore() {
+	if !u.typed {
+		// The store may have fixed the type.
+		u.v.Reset()
+		if !u.ok {
+			return
+		}
+	}
+	u.v.TryStore(u.prev)
+}
+
+// A Snapshot is a consistent read view of a Group.
+type Snapshot struct {
+	g *Group
+	s groupState
+}
+
+// Version returns the number of Commits the snapshot reflects.
+func (s Snapshot) Version() uint64 {
+	return s.s.version
+}
+
+// Load returns the value of the member v in the snapshot.
+// It panics if v is not a member of the Group.
+func (s Snapshot) Load(v *Value) (val any) {
+	return s.s.vals[s.g.slot(v)]
+}
+
+// A Writer collects the values of a Group Commit.
+type Writer struct {
+	g       *Group
+	vals    []any
+	changed []bool // by slot
+	dirty   bool
+}
+
+// Load returns the value of the member v, including the stores made
+// so far by the commit.
+func (w *Writer) Load(v *Value) (val any) {
+	return w.vals[w.g.slot(v)]
+}
+
+// Store sets the value of the member v when the commit publishes.
+// As with Value, every value of a member must be of the same concrete
+// type, Store of an inconsistent type panics with ErrInconsistentType.
+func (w *Writer) Store(v *Value, val any) {
+	i := w.g.slot(v)
+	if typ := typeOf(val); typ != nil {
+		old := typeOf(w.vals[i])
+		if old == nil {
+			old = v.loadType()
+		}
+		if old != nil && old != typ {
+			panic(ErrInconsistentType)
+		}
+	}
+	w.vals[i] = val
+	w.changed[i] = true
+	w.dirty = true
+}
@@ -0,0 +1,131 @@
+package store_test
+
+import (
+	"errors"
+	"runtime"
+	"store"
+	"sync"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var host, port, other store.Value
+	host.Store("localhost")
+	g := store.NewGroup(&host, &port)
+	s := g.Snapshot()
+	if s.Version() != 0 || s.Load(&host) != "localhost" || s.Load(&port) != nil {
+		t.Fatalf("initial snapshot: got %v %v %v", s.Version(), s.Load(&host), s.Load(&port))
+	}
+	if err := g.Commit(func(w *store.Writer) {
+		w.Store(&host, "example.com")
+		w.Store(&port, 443)
+		if v := w.Load(&port); v != 443 {
+			t.Error(fmtfn("writer load", v, 443))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Load(&host) != "localhost" {
+		t.Fatal("old snapshot changed")
+	}
+	s = g.Snapshot()
+	if s.Version() != 1 || s.Load(&host) != "example.com" || s.Load(&port) != 443 {
+		t.Fatalf("snapshot after commit: got %v %v %v", s.Version(), s.Load(&host), s.Load(&port))
+	}
+	if host.Load() != "example.com" || port.Load() != 443 {
+		t.Fatalf("members after commit: got %v %v", host.Load(), port.Load())
+	}
+	g.Commit(func(w *store.Writer) {})
+	if v := g.Snapshot().Version(); v != 1 {
+		t.Fatal(fmtfn("version after empty commit", v, 1))
+	}
+
+	for name, fn := range map[string]func(w *store.Writer){
+		"inconsistent type": func(w *store.Writer) { w.Store(&port, "443") },
+		"nil then other type": func(w *store.Writer) {
+			w.Store(&port, nil)
+			w.Store(&port, "443")
+		},
+		"not a member": func(w *store.Writer) { w.Store(&other, 1) },
+	} {
+		func() {
+			defer func() {
+				r := recover()
+				if err, ok := r.(error); r == nil || ok && !errors.Is(err, store.ErrInconsistentType) {
+					t.Errorf("%s: got panic %v", name, r)
+				}
+			}()
+			g.Commit(fn)
+		}()
+	}
+	if port.Load() != 443 || g.Snapshot().Version() != 1 {
+		t.Fatal("a panicking commit published")
+	}
+
+	// A member written directly with another type fails a commit that
+	// changes it, leaving the other members and the snapshot as they were.
+	port.Reset()
+	port.Store("443")
+	if err := g.Commit(func(w *store.Writer) {
+		w.Store(&host, "example.org")
+		w.Store(&port, 8443)
+	}); err != store.ErrInconsistentType {
+		t.Fatalf("commit over a retyped member: got %v, want %v", err, store.ErrInconsistentType)
+	}
+	if host.Load() != "example.com" || g.Snapshot().Version() != 1 {
+		t.Fatal("a failed commit published")
+	}
+	// One that leaves it alone succeeds, without storing into it.
+	if err := g.Commit(func(w *store.Writer) { w.Store(&host, "example.org") }); err != nil {
+		t.Fatal(err)
+	}
+	if host.Load() != "example.org" || port.Load() != "443" || g.Snapshot().Version() != 2 {
+		t.Fatalf("commit of host: got %v %v version %v", host.Load(), port.Load(), g.Snapshot().Version())
+	}
+}
+
+func TestGroupConcurrent(t *testing.T) {
+	vs := make([]store.Value, 20)
+	members := make([]*store.Value, len(vs))
+	for i := range vs {
+		vs[i].Store(0)
+		members[i] = &vs[i]
+	}
+	g := store.NewGroup(members...)
+	p := runtime.GOMAXPROCS(0)
+	n := 2000
+	if testing.Short() {
+		n = 200
+	}
+	var w sync.WaitGroup
+	for i := 0; i < p; i++ {
+		w.Add(2)
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				g.Commit(func(w *store.Writer) {
+					next := w.Load(members[0]).(int) + 1
+					for _, v := range members {
+						w.Store(v, next)
+					}
+				})
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				s := g.Snapshot()
+				for _, v := range members {
+					if x := s.Load(v); x != int(s.Version()) {
+						t.Errorf("snapshot %v holds %v", s.Version(), x)
+						return
+					}
+				}
+			}
+		}()
+	}
+	w.Wait()
+	if v := g.Snapshot().Version(); v != uint64(p*n) {
+		t.Fatal(fmtfn("version", v, p*n))
+	}
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// A History is a Value that remembers the last values stored in it,
+// so that a bad write can be inspected and rolled back.
+//
+// Every write publishes a new immutable record of the kept values with
+// a single compare-and-swap: reads are one atomic load and writes are
+// lock-free, copying the kept entries.
+//
+// The zero History keeps only the current value.
+type History struct {
+	n int
+	p unsafe.Pointer // *historyState
+}
+
+// A HistoryEntry is a value kept by a History.
+type HistoryEntry struct {
+	Seq  uint64 // numbered from 1 by the writes to the History
+	Time time.Time
+	Val  any
+}
+
+type historyState struct {
+	entries []HistoryEntry // oldest first
+	seq     uint64         // of the last write, Reset included
+	typ     unsafe.Pointer // of the non-nil values stored since Reset
+}
+
+var emptyHistory = &historyState{}
+
+func (s *historyState) current() any {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	return s.entries[len(s.entries)-1].Val
+}
+
+// NewHistory returns an empty History keeping the last n values,
+// the current one included. An n below 1 means 1.
+func NewHistory(n int) *History {
+	return &History{n: n}
+}
+
+func (h *History) load() (p unsafe.Pointer, s *historyState) {
+	p = atomic.LoadPointer(&h.p)
+	if p == nil {
+		return nil, emptyHistory
+	}
+	return p, (*historyState)(p)
+}
+
+// publish replaces p, holding s, with the state where val is stored.
+// It fails if p is no longer the current state.
+func (h *History) publish(p unsafe.Pointer, s *historyState, val any) (bool, error) {
+	typ := (*ifaceWords)(unsafe.Pointer(&val)).typ
+	switch {
+	case typ == nil || typ == s.typ:
+		typ = s.typ
+	case s.typ != nil:
+		return false, ErrInconsistentType
+	}
+	entries := s.entries
+	keep := h.n - 1
+	if keep < 0 {
+		keep = 0
+	}
+	if len(entries) > keep {
+		entries = entries[len(entries)-keep:]
+	}
+	next := &historyState{
+		entries: append(cloneSlice(entries, 1), HistoryEntry{Seq: s.seq + 1, Time: time.Now(), Val: val}),
+		seq:     s.seq + 1,
+		typ:     typ,
+	}
+	return atomic.CompareAndSwapPointer(&h.p, p, unsafe.Pointer(next)), nil
+}
+
+// Load returns the value set by the most recent write.
+func (h *History) Load() (val any) {
+	val, _ = h.LoadOk()
+	return val
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// nil, has been stored since the History was created or Reset.
+func (h *History) LoadOk() (val any, ok bool) {
+	return h.Previous(0)
+}
+
+// Reset returns the History to the state where nothing has been
+// stored, forgetting the kept values, after which it accepts a value
+// of a new concrete type. Sequence numbers keep counting.
+func (h *History) Reset() {
+	for {
+		p := atomic.LoadPointer(&h.p)
+		if p == nil {
+			return
+		}
+		next := &historyState{seq: (*historyState)(p).seq + 1}
+		if atomic.CompareAndSwapPointer(&h.p, p, unsafe.Pointer(next)) {
+			return
+		}
+	}
+}
+
+// Store sets the value to val. All non-nil values stored must be of
+// the same concrete type until Reset.
+// Store of an inconsistent type panics with ErrInconsistentType.
+func (h *History) Store(val any) {
+	if err := h.TryStore(val); err != nil {
+		panic(err)
+	}
+}
+
+// TryStore is like Store but returns ErrInconsistentType
+// instead of panicking.
+func (h *History) TryStore(val any) error {
+	_, err := h.TrySwap(val)
+	return err
+}
+
+// Swap stores new and returns the previous value.
+// Swap of an inconsistent type panics with ErrInconsistentType.
+func (h *History) Swap(new any) (old any) {
+	old, err := h.TrySwap(new)
+	if err != nil {
+		panic(err)
+	}
+	return old
+}
+
+// TrySwap is like Swap but returns ErrInconsistentType
+// instead of panicking.
+func (h *History) TrySwap(new any) (old any, err error) {
+	for {
+		p, s := h.load()
+		ok, err := h.publish(p, s, new)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return s.current(), nil
+		}
+	}
+}
+
+// CompareAndSwap executes the compare-and-swap operation for the
+// History. CompareAndSwap of an inconsistent type panics with
+// ErrInconsistentType, and of an uncomparable type with ErrUncomparable.
+func (h *History) CompareAndSwap(old, new any) (swapped bool) {
+	swapped, err := h.TryCompareAndSwap(old, new)
+	if err != nil {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwap is like CompareAndSwap but returns the error
+// instead of panicking.
+func (h *History) TryCompareAndSwap(old, new any) (swapped bool, err error) {
+	for {
+		p, s := h.load()
+		if eq, err := equal(s.current(), old); !eq {
+			return false, err
+		}
+		if ok, err := h.publish(p, s, new); ok || err != nil {
+			return ok, err
+		}
+	}
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns, retrying with the fresh value
+// whenever another writer got there first.
+//
+// It returns the stored value and true, or the last value fn was
+// called with and false if fn declined. Update of an inconsistent
+// type panics with ErrInconsistentType.
+func (h *History) Update(fn func(old any) (new any, ok bool)) (new any, updated bool) {
+	return Retry{}.Update(h, fn)
+}
+
+func (h *History) tryUpdate(fn func(old any) (new any, ok bool)) (val any, updated, done bool) {
+	p, s := h.load()
+	old := s.current()
+	new, ok := fn(old)
+	if !ok {
+		return old, false, true
+	}
+	swapped, err := h.publish(p, s, new)
+	if err != nil {
+		panic(err)
+	}
+	if !swapped {
+		return old, false, false
+	}
+	return new, true, true
+}
+
+// Previous returns the value stored k writes ago, the current value
+// for k = 0, and whether it is still kept.
+func (h *History) Previous(k int) (val any, ok bool) {
+	_, s := h.load()
+	entries := s.entries
+	if k < 0 || k >= len(entries) {
+		return nil, false
+	}
+	return entries[len(entries)-1-k].Val, true
+}
+
+// Rollback stores again the value stored k writes ago, as Previous
+// returns it. The rollback is itself a write, which can be rolled back
+// in turn.
+//
+// Rollback is a compare-and-swap against the state it read: it reports
+// false, storing nothing, if the value is no longer kept or if another
+// write landed in the meantime.
+func (h *History) Rollback(k int) (ok bool) {
+	p, s := h.load()
+	if k < 0 || k >= len(s.entries) {
+		return false
+	}
+	ok, _ = h.publish(p, s, s.entries[len(s.entries)-1-k].Val)
+	return ok
+}
+
+// Entries returns a copy of the kept values, oldest first.
+func (h *History) Entries() []HistoryEntry {
+	_, s := h.load()
+	return cloneSlice(s.entries, 0)
+}
@@ -0,0 +1,117 @@
+package store_test
+
+import (
+	"store"
+	"sync"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	var _ store.Updater = store.NewHistory(3)
+	h := store.NewHistory(3)
+	if _, ok := h.LoadOk(); ok {
+		t.Fatal("new History not empty")
+	}
+	if h.Rollback(0) {
+		t.Fatal("rollback of empty History")
+	}
+	for i := 1; i <= 5; i++ {
+		h.Store(i)
+	}
+	for k, want := range []any{5, 4, 3} {
+		if x, ok := h.Previous(k); !ok || x != want {
+			t.Fatal(fmtfn("previous", x, want))
+		}
+	}
+	if _, ok := h.Previous(3); ok {
+		t.Fatal("previous beyond the kept values")
+	}
+	entries := h.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.Seq != uint64(i+3) || e.Val != i+3 || e.Time.IsZero() {
+			t.Fatalf("entry %d: got %+v", i, e)
+		}
+	}
+
+	if !h.Rollback(2) || h.Load() != 3 {
+		t.Fatal(fmtfn("rollback", h.Load(), 3))
+	}
+	if x, _ := h.Previous(1); x != 5 {
+		t.Fatal(fmtfn("previous after rollback", x, 5))
+	}
+	if h.Rollback(3) {
+		t.Fatal("rollback beyond the kept values")
+	}
+	if e := h.Entries(); e[len(e)-1].Seq != 6 {
+		t.Fatal(fmtfn("seq after rollback", e[len(e)-1].Seq, 6))
+	}
+
+	if err := h.TryStore("x"); err != store.ErrInconsistentType {
+		t.Fatal(fmtfn("store of another type", err, store.ErrInconsistentType))
+	}
+	if !h.CompareAndSwap(3, 4) || h.CompareAndSwap(3, 5) {
+		t.Fatal("cas wrong result")
+	}
+	if x, ok := h.Update(incr); !ok || x != 5 {
+		t.Fatal(fmtfn("update", x, 5))
+	}
+	h.Reset()
+	if _, ok := h.LoadOk(); ok || len(h.Entries()) != 0 {
+		t.Fatal("Reset kept values")
+	}
+	h.Store("x")
+	if e := h.Entries(); len(e) != 1 || e[0].Seq != 10 {
+		t.Fatalf("after Reset: got %+v", e)
+	}
+}
+
+func TestHistoryZero(t *testing.T) {
+	var h store.History
+	h.Store(1)
+	h.Store(2)
+	if _, ok := h.Previous(1); ok || h.Rollback(1) {
+		t.Fatal("zero History kept a previous value")
+	}
+	if x := h.Swap(3); x != 2 {
+		t.Fatal(fmtfn("swap", x, 2))
+	}
+}
+
+func TestHistoryRollbackRace(t *testing.T) {
+	h := store.NewHistory(8)
+	h.Store(0)
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= n; i++ {
+			h.Store(i)
+		}
+	}()
+	rollbacks := 0
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			if h.Rollback(1) {
+				rollbacks++
+			}
+		}
+	}()
+	wg.Wait()
+	e := h.Entries()
+	if last := e[len(e)-1].Seq; last != uint64(n+1+rollbacks) {
+		t.Fatal(fmtfn("writes", last, n+1+rollbacks))
+	}
+	for i := 1; i < len(e); i++ {
+		if e[i].Seq != e[i-1].Seq+1 {
+			t.Fatalf("entries %+v not consecutive", e)
+		}
+	}
+}
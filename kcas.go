@@ -0,0 +1,199 @@
+package store
+
+import (
+	"sort"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A CASOp is one compare-and-swap of CompareAndSwapN:
+// if Entry holds a value equal to Old, replace it with New.
+type CASOp struct {
+	Entry    *Entry
+	Old, New any
+}
+
+// CompareAndSwapN executes the compare-and-swap operations of ops as
+// one atomic step: either every Entry held its Old value and now holds
+// its New one, or none of them is changed and it returns false.
+//
+// It is lock-free, after Harris, Fraser and Pratt's MCAS. It panics
+// if an Entry appears twice in ops, and with ErrUncomparable when
+// comparing uncomparable values.
+func CompareAndSwapN(ops ...CASOp) (swapped bool) {
+	swapped, err := TryCompareAndSwapN(ops...)
+	if err != nil {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwapN is like CompareAndSwapN but returns
+// ErrUncomparable instead of panicking.
+func TryCompareAndSwapN(ops ...CASOp) (swapped bool, err error) {
+	mops := make([]mcasOp, len(ops))
+	for i, op := range ops {
+		new := op.New
+		mops[i] = mcasOp{e: op.Entry, old: op.Old, new: unsafe.Pointer(&new)}
+	}
+	d := newMCAS(mops)
+	for i := 1; i < len(d.ops); i++ {
+		if d.ops[i].e == d.ops[i-1].e {
+			panic("store: CompareAndSwapN of the same Entry twice")
+		}
+	}
+	if d.help() {
+		d.wake()
+		return true, nil
+	}
+	err, _ = d.err.Load().(error)
+	return false, err
+}
+
+const (
+	mcasUndecided int32 = iota
+	mcasSucceeded
+	mcasFailed
+)
+
+// mcasDesc describes a CompareAndSwapN in progress. Whoever meets it
+// in an Entry helps it to completion before going on.
+type mcasDesc struct {
+	status int32
+	ops    []mcasOp // sorted by Entry address
+	err    Entry    // a comparison error, if any
+}
+
+type mcasOp struct {
+	e     *Entry
+	old   any
+	oldp  unsafe.Pointer // compared instead of old if byPtr
+	byPtr bool
+	new   unsafe.Pointer // *any
+}
+
+func newMCAS(ops []mcasOp) *mcasDesc {
+	// Entries are always taken in the same order, so that operations
+	// sharing some only help each other instead of fighting.
+	sort.Slice(ops, func(i, j int) bool {
+		return uintptr(unsafe.Pointer(ops[i].e)) < uintptr(unsafe.Pointer(ops[j].e))
+	})
+	return &mcasDesc{ops: ops}
+}
+
+// expects reports whether p is the value op expects.
+func (op *mcasOp) expects(p unsafe.Pointer) (bool, error) {
+	if op.byPtr {
+		return p == op.oldp, nil
+	}
+	return equal(ptr2any(p), op.old)
+}
+
+// mcasRef stands in for the value of an Entry that a descriptor holds.
+//
+// Taking an Entry is a two step restricted double compare-and-swap:
+// a pending ref first replaces the expected value, then becomes an
+// owning ref if the descriptor is still undecided, or is rolled back.
+// A late helper can thus never take an Entry for a decided descriptor.
+type mcasRef struct {
+	d       *mcasDesc
+	orig    unsafe.Pointer // the value pointer it replaced
+	pending bool
+}
+
+// asRef returns the ref p points to, if any.
+func asRef(p unsafe.Pointer) *mcasRef {
+	if p == nil {
+		return nil
+	}
+	r, _ := (*(*any)(p)).(*mcasRef)
+	return r
+}
+
+func (r *mcasRef) box() unsafe.Pointer {
+	var x any = r
+	return unsafe.Pointer(&x)
+}
+
+// resolve moves e, found holding r at p, past r.
+func (r *mcasRef) resolve(e *Entry, p unsafe.Pointer) {
+	if r.pending {
+		r.settle(e, p)
+	} else {
+		r.d.help()
+	}
+}
+
+// settle turns the pending ref r, found in e at p, into an owning ref
+// or rolls it back. The status must be read after r was seen in e.
+func (r *mcasRef) settle(e *Entry, p unsafe.Pointer) {
+	next := r.orig
+	if atomic.LoadInt32(&r.d.status) == mcasUndecided {
+		next = (&mcasRef{d: r.d, orig: r.orig}).box()
+	}
+	atomic.CompareAndSwapPointer(&e.p, p, next)
+}
+
+// wake wakes the WaitFor calls on the entries d wrote, once it
+// succeeded.
+func (d *mcasDesc) wake() {
+	for i := range d.ops {
+		if op := &d.ops[i]; !op.byPtr || op.new != op.oldp {
+			wake(&op.e.w)
+		}
+	}
+}
+
+// help takes the entries of d in order, decides d and then releases
+// them, reporting whether d succeeded.
+func (d *mcasDesc) help() bool {
+	status := mcasSucceeded
+	for i := 0; i < len(d.ops) && atomic.LoadInt32(&d.status) == mcasUndecided; {
+		op := &d.ops[i]
+		p := atomic.LoadPointer(&op.e.p)
+		if r := asRef(p); r != nil {
+			if r.d == d && !r.pending {
+				i++
+			} else {
+				r.resolve(op.e, p)
+			}
+			continue
+		}
+		eq, err := op.expects(p)
+		if err != nil {
+			d.err.Store(err)
+		}
+		if !eq {
+			status = mcasFailed
+			break
+		}
+		r := &mcasRef{d: d, orig: p, pending: true}
+		if rp := r.box(); atomic.CompareAndSwapPointer(&op.e.p, p, rp) {
+			r.settle(op.e, rp)
+		}
+	}
+	atomic.CompareAndSwapInt32(&d.status, mcasUndecided, status)
+	succeeded := atomic.LoadInt32(&d.status) == mcasSucceeded
+
+	for i := range d.ops {
+		op := &d.ops[i]
+		for {
+			p := atomic.LoadPointer(&op.e.p)
+			r := asRef(p)
+			if r == nil || r.d != d {
+				break
+			}
+			if r.pending {
+				r.settle(op.e, p)
+				continue
+			}
+			next := r.orig
+			if succeeded {
+				next = op.new
+			}
+			atomic.CompareAndSwapPointer(&op.e.p, p, next)
+			break
+		}
+	}
+	return succeeded
+}
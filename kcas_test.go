@@ -0,0 +1,146 @@
+package store_test
+
+import (
+	"errors"
+	"runtime"
+	"store"
+	"sync"
+	"testing"
+)
+
+func TestCompareAndSwapN(t *testing.T) {
+	var a, b, c store.Entry
+	a.Store(1)
+	b.Store("foo")
+	if !store.CompareAndSwapN(
+		store.CASOp{Entry: &a, Old: 1, New: 2},
+		store.CASOp{Entry: &b, Old: "foo", New: "bar"},
+		store.CASOp{Entry: &c, Old: nil, New: 3.0},
+	) {
+		t.Fatal("CompareAndSwapN of matching values should succeed")
+	}
+	if a.Load() != 2 || b.Load() != "bar" || c.Load() != 3.0 {
+		t.Fatalf("after swap: got %v %v %v, want 2 bar 3", a.Load(), b.Load(), c.Load())
+	}
+	if store.CompareAndSwapN(
+		store.CASOp{Entry: &a, Old: 2, New: 4},
+		store.CASOp{Entry: &b, Old: "foo", New: "baz"},
+	) {
+		t.Fatal("CompareAndSwapN with a stale value should fail")
+	}
+	if a.Load() != 2 || b.Load() != "bar" {
+		t.Fatalf("after failed swap: got %v %v, want 2 bar", a.Load(), b.Load())
+	}
+	if _, ok := a.LoadOk(); !ok {
+		t.Fatal("failed swap lost the stored state")
+	}
+	if !store.CompareAndSwapN() {
+		t.Fatal("CompareAndSwapN of nothing should succeed")
+	}
+}
+
+func TestCompareAndSwapNPanics(t *testing.T) {
+	var a, b store.Entry
+	a.Store([]int{1})
+	_, err := store.TryCompareAndSwapN(
+		store.CASOp{Entry: &b, Old: nil, New: 1},
+		store.CASOp{Entry: &a, Old: []int{1}, New: 2},
+	)
+	if !errors.Is(err, store.ErrUncomparable) {
+		t.Fatalf("uncomparable: got '%v', want '%v'", err, store.ErrUncomparable)
+	}
+	if v, ok := b.LoadOk(); v != nil || ok {
+		t.Fatalf("uncomparable swap changed another entry to %v %v", v, ok)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("same entry twice should panic")
+			}
+		}()
+		store.CompareAndSwapN(
+			store.CASOp{Entry: &b, Old: nil, New: 1},
+			store.CASOp{Entry: &b, Old: nil, New: 2},
+		)
+	}()
+}
+
+// TestCompareAndSwapNConcurrent moves units between entries while
+// readers and plain writers use them: no unit may be lost, and a
+// reader must never see half of a move.
+func TestCompareAndSwapNConcurrent(t *testing.T) {
+	const k = 4
+	var accounts [k]store.Entry
+	for i := range accounts {
+		accounts[i].Store(100)
+	}
+	// pair is always written as a whole, so x never falls behind y
+	// when read first.
+	var x, y store.Entry
+	x.Store(0)
+	y.Store(0)
+
+	p := runtime.GOMAXPROCS(0)
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	var w sync.WaitGroup
+	for g := 0; g < p; g++ {
+		g := g
+		w.Add(3)
+		go func() {
+			defer w.Done()
+			for i := 0; i < n; i++ {
+				from, to := &accounts[(g+i)%k], &accounts[(g+i+1)%k]
+				for {
+					a, b := from.Load().(int), to.Load().(int)
+					if store.CompareAndSwapN(
+						store.CASOp{Entry: from, Old: a, New: a - 1},
+						store.CASOp{Entry: to, Old: b, New: b + 1},
+					) {
+						break
+					}
+				}
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for i := 0; i < n; i++ {
+				for {
+					v := y.Load().(int)
+					if store.CompareAndSwapN(
+						store.CASOp{Entry: &y, Old: v, New: v + 1},
+						store.CASOp{Entry: &x, Old: v, New: v + 1},
+					) {
+						break
+					}
+				}
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for i := 0; i < n; i++ {
+				// Plain writes take part too.
+				a := &accounts[i%k]
+				a.Update(func(old any) (any, bool) { return old.(int) + 0, true })
+				yv := y.Load().(int)
+				if xv := x.Load().(int); xv < yv {
+					t.Errorf("saw a half-applied swap: x %v behind y %v", xv, yv)
+					return
+				}
+			}
+		}()
+	}
+	w.Wait()
+	total := 0
+	for i := range accounts {
+		total += accounts[i].Load().(int)
+	}
+	if total != 100*k {
+		t.Errorf("accounts sum to %v, want %v", total, 100*k)
+	}
+	if x.Load() != p*n || y.Load() != p*n {
+		t.Errorf("pair: got %v %v, want %v", x.Load(), y.Load(), p*n)
+	}
+}
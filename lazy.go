@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrLoaderPanicked is returned to the goroutines waiting for a load
+// of a Lazy whose New panicked. The goroutine that called New panics.
+var ErrLoaderPanicked = errors.New("store: Lazy loader panicked")
+
+// A Lazy loads a value on first use and caches it. Concurrent Gets
+// share a single call of New, the others wait for its result.
+//
+// The call is published through a Value: the Get whose
+// CompareAndSwap takes the empty Value, or one holding a result to
+// reload, calls New, the others find the call there and wait for it.
+// Gets after the first are a single atomic load.
+//
+// A Lazy must not be copied after first use.
+type Lazy struct {
+	// New loads the value.
+	New func() (any, error)
+
+	// ErrorTTL is how long an error from New is returned before
+	// loading again: 0 retries on the next Get, a negative ErrorTTL
+	// keeps the error until Invalidate.
+	ErrorTTL time.Duration
+
+	v Value // *lazyCall
+}
+
+// lazyCall is a call of New, and then its result.
+type lazyCall struct {
+	done    chan struct{} // closed once the fields below are set
+	val     any
+	err     error
+	expires time.Time // for errors, zero means never
+}
+
+// fresh reports whether the result of c, which is done, can be
+// returned instead of loading again.
+func (c *lazyCall) fresh() bool {
+	return c.err == nil || c.expires.IsZero() || time.Now().Before(c.expires)
+}
+
+// OnceValue returns a function that calls f on first use and then
+// returns its results, errors included, without calling it again.
+func OnceValue(f func() (any, error)) func() (any, error) {
+	l := &Lazy{New: f, ErrorTTL: -1}
+	return l.Get
+}
+
+// Get returns the loaded value, loading it first if needed.
+func (l *Lazy) Get() (val any, err error) {
+	for {
+		cur := l.v.Load()
+		if c, _ := cur.(*lazyCall); c != nil {
+			select {
+			case <-c.done:
+				if c.fresh() {
+					return c.val, c.err
+				}
+			default:
+				<-c.done
+				return c.val, c.err
+			}
+		}
+		c := &lazyCall{done: make(chan struct{})}
+		if l.v.CompareAndSwap(cur, c) {
+			l.load(c)
+			return c.val, c.err
+		}
+	}
+}
+
+// load calls New for c and sets its result. A result Invalidate
+// dropped meanwhile is still returned to the Gets waiting for it.
+func (l *Lazy) load(c *lazyCall) {
+	c.err = ErrLoaderPanicked
+	defer func() {
+		switch {
+		case c.err == ErrLoaderPanicked || c.err != nil && l.ErrorTTL == 0:
+			// Load again on the next Get.
+			c.expires = time.Now()
+		case c.err != nil && l.ErrorTTL > 0:
+			c.expires = time.Now().Add(l.ErrorTTL)
+		}
+		close(c.done)
+	}()
+	c.val, c.err = l.New()
+}
+
+// Invalidate drops the loaded value, or cached error, so that the
+// next Get loads again. A load in progress still returns its result
+// to the Gets waiting for it, but not to later ones.
+func (l *Lazy) Invalidate() {
+	l.v.Reset()
+}
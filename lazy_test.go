@@ -0,0 +1,159 @@
+package store_test
+
+import (
+	"errors"
+	"runtime"
+	"store"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLazy(t *testing.T) {
+	var calls int32
+	l := &store.Lazy{New: func() (any, error) {
+		return int(atomic.AddInt32(&calls, 1)), nil
+	}}
+	for i := 0; i < 3; i++ {
+		if v, err := l.Get(); v != 1 || err != nil {
+			t.Fatalf("Get: got %v %v, want 1 nil", v, err)
+		}
+	}
+	l.Invalidate()
+	if v, _ := l.Get(); v != 2 {
+		t.Fatal(fmtfn("Get after Invalidate", v, 2))
+	}
+}
+
+func TestLazyConcurrent(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	l := &store.Lazy{New: func() (any, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "done", nil
+	}}
+	var w sync.WaitGroup
+	for i := 0; i < 4*runtime.GOMAXPROCS(0); i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			if v, err := l.Get(); v != "done" || err != nil {
+				t.Errorf("Get: got %v %v, want done nil", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	w.Wait()
+	if calls != 1 {
+		t.Fatal(fmtfn("loader calls", calls, 1))
+	}
+}
+
+func TestLazyErrors(t *testing.T) {
+	errLoad := errors.New("load failed")
+	var calls int32
+	newLoader := func() func() (any, error) {
+		calls = 0
+		return func() (any, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errLoad
+		}
+	}
+	for _, tt := range []struct {
+		name  string
+		ttl   time.Duration
+		sleep time.Duration
+		calls int32
+	}{
+		{"retry", 0, 0, 3},
+		{"cache", -1, 0, 1},
+		{"ttl", time.Hour, 0, 1},
+		{"ttl expired", 5 * time.Millisecond, 10 * time.Millisecond, 3},
+	} {
+		l := &store.Lazy{New: newLoader(), ErrorTTL: tt.ttl}
+		for i := 0; i < 3; i++ {
+			if _, err := l.Get(); err != errLoad {
+				t.Fatalf("%s: got %v, want %v", tt.name, err, errLoad)
+			}
+			time.Sleep(tt.sleep)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: loader called %v times, want %v", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+func TestLazyInvalidateDuringLoad(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	l := &store.Lazy{New: func() (any, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+			return "stale", nil
+		}
+		return "fresh", nil
+	}}
+	done := make(chan any)
+	go func() {
+		v, _ := l.Get()
+		done <- v
+	}()
+	<-started
+	l.Invalidate()
+	close(release)
+	if v := <-done; v != "stale" {
+		t.Fatal(fmtfn("waiting Get", v, "stale"))
+	}
+	if v, _ := l.Get(); v != "fresh" {
+		t.Fatal(fmtfn("Get after Invalidate", v, "fresh"))
+	}
+}
+
+func TestLazyPanic(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	l := &store.Lazy{New: func() (any, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+			panic("boom")
+		}
+		return "ok", nil
+	}}
+	go func() {
+		defer func() { recover() }()
+		l.Get()
+	}()
+	<-started
+	done := make(chan error)
+	go func() {
+		_, err := l.Get()
+		done <- err
+	}()
+	// Let the second Get find the load in progress.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-done; !errors.Is(err, store.ErrLoaderPanicked) {
+		t.Fatalf("waiting Get: got %v, want %v", err, store.ErrLoaderPanicked)
+	}
+	if v, err := l.Get(); v != "ok" || err != nil {
+		t.Fatalf("Get after a panic: got %v %v, want ok nil", v, err)
+	}
+}
+
+func TestOnceValue(t *testing.T) {
+	calls := 0
+	f := store.OnceValue(func() (any, error) {
+		calls++
+		return calls, errors.New("once")
+	})
+	for i := 0; i < 3; i++ {
+		if v, err := f(); v != 1 || err == nil {
+			t.Fatalf("OnceValue: got %v %v, want 1 once", v, err)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"hash/maphash"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Map is a lock-free concurrent map, a hash array mapped trie whose
+// slots are Entry values. Like Entry, it holds values of mixed types
+// and nil values. Keys must be comparable, an unhashable key panics.
+//
+// The zero Map is empty and ready for use.
+// A Map must not be copied after first use.
+type Map struct {
+	n    int64 // number of keys
+	root Entry // *mapIndirect, set on first write
+}
+
+const (
+	mapBits     = 4
+	mapFanout   = 1 << mapBits
+	mapMask     = mapFanout - 1
+	mapHashBits = 8 * unsafe.Sizeof(uintptr(0))
+)
+
+// mapIndirect is an inner node of the trie, each child is nil,
+// a *mapIndirect or a *mapBucket.
+type mapIndirect struct {
+	children [mapFanout]Entry
+}
+
+// mapBucket holds the leaves of a slot, all of the same hash.
+// It is never modified: a write replaces it with a copy.
+type mapBucket struct {
+	hash   uintptr
+	leaves []*mapLeaf
+}
+
+type mapLeaf struct {
+	key any
+	val Entry // the value, expunged once the key is deleted
+}
+
+// expunged marks the value of a deleted leaf,
+// it is never replaced once stored.
+var expunged = new(any)
+
+var mapSeed = func() uintptr {
+	var h maphash.Hash
+	return uintptr(h.Sum64())
+}()
+
+func hashOf(key any) uintptr {
+	return runtime_nilinterhash(unsafe.Pointer(&key), mapSeed)
+}
+
+// live returns the leaf of key that has not been deleted, if any.
+func (b *mapBucket) live(key any) *mapLeaf {
+	for _, l := range b.leaves {
+		if l.key == key && l.val.Load() != expunged {
+			return l
+		}
+	}
+	return nil
+}
+
+// with returns a copy of b without its deleted leaves, plus l if not nil.
+// It returns nil instead of an empty bucket.
+func (b *mapBucket) with(l *mapLeaf) *mapBucket {
+	leaves := make([]*mapLeaf, 0, len(b.leaves)+1)
+	for _, x := range b.leaves {
+		if x.val.Load() != expunged {
+			leaves = append(leaves, x)
+		}
+	}
+	if l != nil {
+		leaves = append(leaves, l)
+	}
+	if len(leaves) == 0 {
+		return nil
+	}
+	return &mapBucket{hash: b.hash, leaves: leaves}
+}
+
+func (m *Map) rootNode() *mapIndirect {
+	if r, _ := m.root.Load().(*mapIndirect); r != nil {
+		return r
+	}
+	m.root.CompareAndSwap(nil, &mapIndirect{})
+	return m.root.Load().(*mapIndirect)
+}
+
+// leaf returns the live leaf of key. If there is none and create is
+// set, it inserts a new leaf holding val and returns it with true.
+func (m *Map) leaf(key any, create bool, val any) (l *mapLeaf, inserted bool) {
+	h := hashOf(key)
+	var ind *mapIndirect
+	if create {
+		ind = m.rootNode()
+	} else if ind, _ = m.root.Load().(*mapIndirect); ind == nil {
+		return nil, false
+	}
+	for shift := uintptr(0); ; {
+		slot := &ind.children[(h>>shift)&mapMask]
+		switch c := slot.Load().(type) {
+		case *mapIndirect:
+			ind = c
+			shift += mapBits
+		case *mapBucket:
+			if c.hash == h {
+				if l := c.live(key); l != nil {
+					return l, false
+				}
+			}
+			if !create {
+				return nil, false
+			}
+			if c.hash != h {
+				// Push the bucket one level down and retry there.
+				next := &mapIndirect{}
+				next.children[(c.hash>>(shift+mapBits))&mapMask].Store(c)
+				slot.CompareAndSwap(c, next)
+				continue
+			}
+			l := &mapLeaf{key: key}
+			l.val.Store(val)
+			if slot.CompareAndSwap(c, c.with(l)) {
+				atomic.AddInt64(&m.n, 1)
+				return l, true
+			}
+		case nil:
+			if !create {
+				return nil, false
+			}
+			l := &mapLeaf{key: key}
+			l.val.Store(val)
+			if slot.CompareAndSwap(nil, &mapBucket{hash: h, leaves: []*mapLeaf{l}}) {
+				atomic.AddInt64(&m.n, 1)
+				return l, true
+			}
+		}
+	}
+}
+
+// unlink removes the deleted leaves of key's bucket from the trie.
+// It gives up if another writer changes the bucket first, the next
+// write to that bucket will drop them.
+func (m *Map) unlink(key any) {
+	h := hashOf(key)
+	ind, _ := m.root.Load().(*mapIndirect)
+	for shift := uintptr(0); ind != nil; shift += mapBits {
+		slot := &ind.children[(h>>shift)&mapMask]
+		switch c := slot.Load().(type) {
+		case *mapIndirect:
+			ind = c
+		case *mapBucket:
+			if b := c.with(nil); b == nil {
+				slot.CompareAndSwap(c, nil)
+			} else {
+				slot.CompareAndSwap(c, b)
+			}
+			return
+		default:
+			return
+		}
+	}
+}
+
+// expunge deletes l if its value satisfies ok, returning the value.
+func (m *Map) expunge(l *mapLeaf, ok func(val any) bool) (val any, deleted bool) {
+	_, deleted = l.val.Update(func(old any) (any, bool) {
+		val = old
+		if old == expunged || !ok(old) {
+			return nil, false
+		}
+		return expunged, true
+	})
+	if !deleted {
+		return nil, false
+	}
+	atomic.AddInt64(&m.n, -1)
+	m.unlink(l.key)
+	return val, true
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present. The ok result indicates whether value was found.
+func (m *Map) Load(key any) (value any, ok bool) {
+	l, _ := m.leaf(key, false, nil)
+	if l == nil {
+		return nil, false
+	}
+	if value = l.val.Load(); value == expunged {
+		return nil, false
+	}
+	return value, true
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key, value any) {
+	for {
+		l, inserted := m.leaf(key, true, value)
+		if inserted {
+			return
+		}
+		if _, ok := l.val.Update(func(old any) (any, bool) {
+			return value, old != expunged
+		}); ok {
+			return
+		}
+	}
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key, value any) (actual any, loaded bool) {
+	for {
+		l, inserted := m.leaf(key, true, value)
+		if inserted {
+			return value, false
+		}
+		if actual = l.val.Load(); actual != expunged {
+			return actual, true
+		}
+	}
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous
+// value if any. The loaded result reports whether the key was present.
+func (m *Map) LoadAndDelete(key any) (value any, loaded bool) {
+	l, _ := m.leaf(key, false, nil)
+	if l == nil {
+		return nil, false
+	}
+	return m.expunge(l, func(any) bool { return true })
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key any) {
+	m.LoadAndDelete(key)
+}
+
+// CompareAndSwap swaps the old and new values for key if the value
+// stored in the map is equal to old. The old value must be of a
+// comparable type.
+func (m *Map) CompareAndSwap(key, old, new any) (swapped bool) {
+	l, _ := m.leaf(key, false, nil)
+	if l == nil {
+		return false
+	}
+	_, swapped = l.val.Update(func(cur any) (any, bool) {
+		return new, cur != expunged && cur == old
+	})
+	return swapped
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal
+// to old. The old value must be of a comparable type.
+func (m *Map) CompareAndDelete(key, old any) (deleted bool) {
+	l, _ := m.leaf(key, false, nil)
+	if l == nil {
+		return false
+	}
+	_, deleted = m.expunge(l, func(cur any) bool { return cur == old })
+	return deleted
+}
+
+// Range calls f sequentially for each key and value present in the
+// map. If f returns false, range stops the iteration.
+//
+// As with sync.Map, Range does not correspond to any consistent
+// snapshot of the Map's contents.
+func (m *Map) Range(f func(key, value any) bool) {
+	if root, _ := m.root.Load().(*mapIndirect); root != nil {
+		root.rangeLeaves(f)
+	}
+}
+
+func (n *mapIndirect) rangeLeaves(f func(key, value any) bool) bool {
+	for i := range n.children {
+		switch c := n.children[i].Load().(type) {
+		case *mapIndirect:
+			if !c.rangeLeaves(f) {
+				return false
+			}
+		case *mapBucket:
+			for _, l := range c.leaves {
+				if v := l.val.Load(); v != expunged && !f(l.key, v) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Len returns the number of keys in the map.
+// Under concurrent writes it is only an estimate.
+func (m *Map) Len() int {
+	return int(atomic.LoadInt64(&m.n))
+}
+
+//go:linkname runtime_nilinterhash runtime.nilinterhash
+func runtime_nilinterhash(p unsafe.Pointer, h uintptr) uintptr
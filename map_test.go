@@ -0,0 +1,187 @@
+package store_test
+
+import (
+	"math/rand"
+	"runtime"
+	"store"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	var m store.Map
+	if v, ok := m.Load("foo"); v != nil || ok {
+		t.Fatalf("Load on empty: got %v %v, want nil false", v, ok)
+	}
+	m.Store("foo", 1)
+	m.Store(2, nil)
+	m.Store(nil, "bar")
+	for _, tt := range []struct{ key, val any }{{"foo", 1}, {2, nil}, {nil, "bar"}} {
+		if v, ok := m.Load(tt.key); v != tt.val || !ok {
+			t.Fatalf("Load(%v): got %v %v, want %v true", tt.key, v, ok, tt.val)
+		}
+	}
+	if n := m.Len(); n != 3 {
+		t.Fatal(fmtfn("len", n, 3))
+	}
+	if v, loaded := m.LoadOrStore("foo", 2); v != 1 || !loaded {
+		t.Fatalf("LoadOrStore: got %v %v, want 1 true", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("baz", []int{1}); loaded || v.([]int)[0] != 1 {
+		t.Fatalf("LoadOrStore: got %v %v, want [1] false", v, loaded)
+	}
+	if m.CompareAndSwap("foo", 2, 3) || !m.CompareAndSwap("foo", 1, 3) {
+		t.Fatal("CompareAndSwap wrong result")
+	}
+	if m.CompareAndDelete("foo", 1) || !m.CompareAndDelete("foo", 3) {
+		t.Fatal("CompareAndDelete wrong result")
+	}
+	if v, loaded := m.LoadAndDelete(2); v != nil || !loaded {
+		t.Fatalf("LoadAndDelete: got %v %v, want nil true", v, loaded)
+	}
+	if v, loaded := m.LoadAndDelete(2); v != nil || loaded {
+		t.Fatalf("LoadAndDelete again: got %v %v, want nil false", v, loaded)
+	}
+	m.Delete("baz")
+	if n := m.Len(); n != 1 {
+		t.Fatal(fmtfn("len", n, 1))
+	}
+	m.Store("foo", 4)
+	if v, ok := m.Load("foo"); v != 4 || !ok {
+		t.Fatalf("Load after delete and store: got %v %v, want 4 true", v, ok)
+	}
+}
+
+func TestMapMatchesReference(t *testing.T) {
+	var m store.Map
+	ref := map[any]any{}
+	r := rand.New(rand.NewSource(1))
+	n := 100000
+	if testing.Short() {
+		n = 10000
+	}
+	for i := 0; i < n; i++ {
+		k, v := r.Intn(1000), r.Intn(4)
+		switch r.Intn(5) {
+		case 0:
+			m.Store(k, v)
+			ref[k] = v
+		case 1:
+			got, loaded := m.LoadOrStore(k, v)
+			want, ok := ref[k]
+			if !ok {
+				want = v
+				ref[k] = v
+			}
+			if got != want || loaded != ok {
+				t.Fatalf("LoadOrStore(%v, %v): got %v %v, want %v %v", k, v, got, loaded, want, ok)
+			}
+		case 2:
+			got, loaded := m.LoadAndDelete(k)
+			want, ok := ref[k]
+			delete(ref, k)
+			if got != want || loaded != ok {
+				t.Fatalf("LoadAndDelete(%v): got %v %v, want %v %v", k, got, loaded, want, ok)
+			}
+		case 3:
+			old := r.Intn(4)
+			want := ref[k] == old
+			if _, ok := ref[k]; !ok {
+				want = false
+			}
+			if got := m.CompareAndSwap(k, old, v); got != want {
+				t.Fatalf("CompareAndSwap(%v, %v, %v): got %v, want %v", k, old, v, got, want)
+			}
+			if want {
+				ref[k] = v
+			}
+		case 4:
+			got, loaded := m.Load(k)
+			want, ok := ref[k]
+			if got != want || loaded != ok {
+				t.Fatalf("Load(%v): got %v %v, want %v %v", k, got, loaded, want, ok)
+			}
+		}
+	}
+	if m.Len() != len(ref) {
+		t.Fatal(fmtfn("len", m.Len(), len(ref)))
+	}
+	seen := 0
+	m.Range(func(key, value any) bool {
+		seen++
+		if want, ok := ref[key]; !ok || want != value {
+			t.Errorf("Range: got %v=%v, want %v %v", key, value, want, ok)
+		}
+		return true
+	})
+	if seen != len(ref) {
+		t.Fatalf("Range: saw %d keys, want %d", seen, len(ref))
+	}
+}
+
+func TestMapRangeStop(t *testing.T) {
+	var m store.Map
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	calls := 0
+	m.Range(func(key, value any) bool {
+		calls++
+		return calls < 10
+	})
+	if calls != 10 {
+		t.Fatal(fmtfn("range calls", calls, 10))
+	}
+}
+
+func TestMapConcurrent(t *testing.T) {
+	var m store.Map
+	var w sync.WaitGroup
+	p := 4 * runtime.GOMAXPROCS(0)
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	for i := 0; i < p; i++ {
+		i := i
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				// Every goroutine stores its own keys, and fights
+				// over shared ones.
+				own := i*n + j
+				m.Store(own, own)
+				if v, ok := m.Load(own); !ok || v != own {
+					t.Errorf("Load(%v): got %v %v, want %v true", own, v, ok, own)
+					return
+				}
+				shared := "shared" + strconv.Itoa(j%64)
+				m.LoadOrStore(shared, 0)
+				for {
+					v, _ := m.Load(shared)
+					c, _ := v.(int)
+					if m.CompareAndSwap(shared, v, c+1) {
+						break
+					}
+				}
+				if j%2 == 0 {
+					m.Delete(own)
+				}
+			}
+		}()
+	}
+	w.Wait()
+	if want := p*n/2 + 64; m.Len() != want {
+		t.Errorf("len: got %v, want %v", m.Len(), want)
+	}
+	total := 0
+	for k := 0; k < 64; k++ {
+		v, _ := m.Load("shared" + strconv.Itoa(k))
+		total += v.(int)
+	}
+	if total != p*n {
+		t.Errorf("shared counters sum to %v, want %v", total, p*n)
+	}
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnregisteredType is returned when marshaling a value whose type
+// was not registered with RegisterType, or unmarshaling an unknown
+// type name.
+var ErrUnregisteredType = errors.New("store: unregistered type")
+
+// types maps type names to types and back for marshaling.
+var types = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: map[string]reflect.Type{},
+	byType: map[reflect.Type]string{},
+}
+
+func init() {
+	RegisterType("[]byte", []byte(nil))
+	for _, x := range []any{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		time.Duration(0), time.Time{},
+	} {
+		RegisterType(reflect.TypeOf(x).String(), x)
+	}
+}
+
+// RegisterType records the concrete type of prototype under name, so
+// that Values and Entries holding that type can be marshaled: the
+// encoded form carries the name, and unmarshaling uses it to recreate
+// a value of the type.
+//
+// The predeclared boolean, string and numeric types, []byte,
+// time.Duration and time.Time are registered under their Go names.
+// RegisterType panics if name is empty or contains a colon, or if the
+// name or the type is already registered.
+func RegisterType(name string, prototype any) {
+	if name == "" || strings.Contains(name, ":") {
+		panic("store: invalid type name " + strconv.Quote(name))
+	}
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		panic("store: RegisterType of nil prototype")
+	}
+	types.Lock()
+	defer types.Unlock()
+	if _, ok := types.byName[name]; ok {
+		panic("store: type name " + strconv.Quote(name) + " registered twice")
+	}
+	if old, ok := types.byType[t]; ok {
+		panic("store: type " + t.String() + " registered twice, as " + strconv.Quote(old))
+	}
+	types.byName[name] = t
+	types.byType[t] = name
+}
+
+func typeName(val any) (string, error) {
+	types.RLock()
+	name, ok := types.byType[reflect.TypeOf(val)]
+	types.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w %T", ErrUnregisteredType, val)
+	}
+	return name, nil
+}
+
+// newOfType returns a pointer to a new zero value of the type
+// registered under name.
+func newOfType(name string) (reflect.Value, error) {
+	types.RLock()
+	t, ok := types.byName[name]
+	types.RUnlock()
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%w %q", ErrUnregisteredType, name)
+	}
+	return reflect.New(t), nil
+}
+
+// The encoded forms below share the same rules for Value and Entry:
+// an empty store, or one holding nil, encodes as null, an empty text
+// or no bytes, all of which decode by resetting the store.
+//
+// The methods have pointer receivers, since a Value or Entry must not
+// be copied, and encoding/json and the others only find them on an
+// addressable field: a struct with a Value field must be marshaled
+// through a pointer, json.Marshal(&cfg) rather than json.Marshal(cfg),
+// which encodes the field as {}. A *Value field works either way.
+
+type jsonEnvelope struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func marshalJSON(val any) ([]byte, error) {
+	if val == nil {
+		return []byte("null"), nil
+	}
+	name, err := typeName(val)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonEnvelope{Type: name, Value: raw})
+}
+
+func unmarshalJSON(data []byte) (val any, ok bool, err error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, false, nil
+	}
+	var env jsonEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, false, err
+	}
+	p, err := newOfType(env.Type)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(env.Value, p.Interface()); err != nil {
+		return nil, false, err
+	}
+	return p.Elem().Interface(), true, nil
+}
+
+// The text form is name:text, where text is the value itself for
+// strings, its MarshalText for TextMarshalers and its JSON otherwise.
+
+func marshalText(val any) ([]byte, error) {
+	if val == nil {
+		return nil, nil
+	}
+	name, err := typeName(val)
+	if err != nil {
+		return nil, err
+	}
+	var text []byte
+	switch x := val.(type) {
+	case encoding.TextMarshaler:
+		text, err = x.MarshalText()
+	default:
+		if v := reflect.ValueOf(val); v.Kind() == reflect.String {
+			text = []byte(v.String())
+		} else {
+			text, err = json.Marshal(val)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(name+":"), text...), nil
+}
+
+func unmarshalText(text []byte) (val any, ok bool, err error) {
+	if len(text) == 0 {
+		return nil, false, nil
+	}
+	i := bytes.IndexByte(text, ':')
+	if i < 0 {
+		return nil, false, errors.New("store: text without type name")
+	}
+	p, err := newOfType(string(text[:i]))
+	if err != nil {
+		return nil, false, err
+	}
+	text = text[i+1:]
+	switch x := p.Interface().(type) {
+	case encoding.TextUnmarshaler:
+		err = x.UnmarshalText(text)
+	default:
+		if p.Elem().Kind() == reflect.String {
+			p.Elem().SetString(string(text))
+		} else {
+			err = json.Unmarshal(text, x)
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return p.Elem().Interface(), true, nil
+}
+
+// The binary form is the length of the name as a uvarint, the name,
+// then the value encoded with gob.
+
+func marshalBinary(val any) ([]byte, error) {
+	if val == nil {
+		return nil, nil
+	}
+	name, err := typeName(val)
+	if err != nil {
+		return nil, err
+	}
+	var n [binary.MaxVarintLen64]byte
+	buf := bytes.NewBuffer(n[:binary.PutUvarint(n[:], uint64(len(name)))])
+	buf.WriteString(name)
+	if err := gob.NewEncoder(buf).Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalBinary(data []byte) (val any, ok bool, err error) {
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	n, k := binary.Uvarint(data)
+	if k <= 0 || n > uint64(len(data)-k) {
+		return nil, false, errors.New("store: malformed binary value")
+	}
+	p, err := newOfType(string(data[k : k+int(n)]))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data[k+int(n):])).DecodeValue(p); err != nil {
+		return nil, false, err
+	}
+	return p.Elem().Interface(), true, nil
+}
+
+// MarshalJSON implements json.Marshaler. The value is encoded as
+// {"type": name, "value": value}, its type must be registered.
+func (s *Value) MarshalJSON() ([]byte, error) { return marshalJSON(s.Load()) }
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Value) UnmarshalJSON(data []byte) error { return s.decode(unmarshalJSON(data)) }
+
+// MarshalText implements encoding.TextMarshaler.
+// The value is encoded as name:text, its type must be registered.
+func (s *Value) MarshalText() ([]byte, error) { return marshalText(s.Load()) }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Value) UnmarshalText(text []byte) error { return s.decode(unmarshalText(text)) }
+
+// MarshalBinary implements encoding.BinaryMarshaler. The value is
+// encoded with gob after its type name, its type must be registered.
+func (s *Value) MarshalBinary() ([]byte, error) { return marshalBinary(s.Load()) }
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Value) UnmarshalBinary(data []byte) error { return s.decode(unmarshalBinary(data)) }
+
+// GobEncode implements gob.GobEncoder like MarshalBinary.
+func (s *Value) GobEncode() ([]byte, error) { return s.MarshalBinary() }
+
+// GobDecode implements gob.GobDecoder like UnmarshalBinary.
+func (s *Value) GobDecode(data []byte) error { return s.UnmarshalBinary(data) }
+
+// decode stores a decoded value, or resets the Value if there is none.
+// A value of another type than the one stored is ErrInconsistentType.
+func (s *Value) decode(val any, ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.Reset()
+		return nil
+	}
+	return s.TryStore(val)
+}
+
+// MarshalJSON implements json.Marshaler. The value is encoded as
+// {"type": name, "value": value}, its type must be registered.
+func (e *Entry) MarshalJSON() ([]byte, error) { return marshalJSON(e.Load()) }
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *Entry) UnmarshalJSON(data []byte) error { return e.decode(unmarshalJSON(data)) }
+
+// MarshalText implements encoding.TextMarshaler.
+// The value is encoded as name:text, its type must be registered.
+func (e *Entry) MarshalText() ([]byte, error) { return marshalText(e.Load()) }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (e *Entry) UnmarshalText(text []byte) error { return e.decode(unmarshalText(text)) }
+
+// MarshalBinary implements encoding.BinaryMarshaler. The value is
+// encoded with gob after its type name, its type must be registered.
+func (e *Entry) MarshalBinary() ([]byte, error) { return marshalBinary(e.Load()) }
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (e *Entry) UnmarshalBinary(data []byte) error { return e.decode(unmarshalBinary(data)) }
+
+// GobEncode implements gob.GobEncoder like MarshalBinary.
+func (e *Entry) GobEncode() ([]byte, error) { return e.MarshalBinary() }
+
+// GobDecode implements gob.GobDecoder like UnmarshalBinary.
+func (e *Entry) GobDecode(data []byte) error { return e.UnmarshalBinary(data) }
+
+// decode stores a decoded value, or resets the Entry if there is none.
+func (e *Entry) decode(val any, ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !ok {
+		e.Reset()
+		return nil
+	}
+	e.Store(val)
+	return nil
+}
@@ -0,0 +1,163 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"store"
+	"testing"
+	"time"
+)
+
+type endpoint struct {
+	Host string
+	Port int
+}
+
+func init() {
+	store.RegisterType("endpoint", endpoint{})
+}
+
+type config struct {
+	Name    store.Value
+	Timeout store.Value
+	Target  store.Entry
+	Unset   store.Entry
+}
+
+func TestMarshalJSON(t *testing.T) {
+	var c config
+	c.Name.Store("api")
+	c.Timeout.Store(time.Second)
+	c.Target.Store(endpoint{"localhost", 80})
+	data, err := json.Marshal(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Name":{"type":"string","value":"api"},"Timeout":{"type":"time.Duration","value":1000000000},` +
+		`"Target":{"type":"endpoint","value":{"Host":"localhost","Port":80}},"Unset":null}`
+	if string(data) != want {
+		t.Fatalf("json: got %s, want %s", data, want)
+	}
+	var d config
+	d.Unset.Store(1)
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Name.Load() != "api" || d.Timeout.Load() != time.Second || d.Target.Load() != (endpoint{"localhost", 80}) {
+		t.Fatalf("unmarshal: got %v %v %v", d.Name.Load(), d.Timeout.Load(), d.Target.Load())
+	}
+	if _, ok := d.Unset.LoadOk(); ok {
+		t.Fatal("null did not reset the Entry")
+	}
+}
+
+func TestMarshalJSONByValue(t *testing.T) {
+	// Passed by value, the fields are not addressable, and their
+	// pointer methods are not used.
+	var c config
+	c.Name.Store("api")
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Name":{},"Timeout":{},"Target":{},"Unset":{}}`; string(data) != want {
+		t.Fatalf("json by value: got %s, want %s", data, want)
+	}
+
+	// Pointer fields work by value.
+	type pconfig struct {
+		Name *store.Value
+	}
+	p := pconfig{Name: &c.Name}
+	if data, err = json.Marshal(p); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Name":{"type":"string","value":"api"}}`; string(data) != want {
+		t.Fatalf("json of pointer field by value: got %s, want %s", data, want)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	var e store.Entry
+	e.Store(struct{}{})
+	if _, err := json.Marshal(&e); !errors.Is(err, store.ErrUnregisteredType) {
+		t.Fatalf("unregistered marshal: got %v, want %v", err, store.ErrUnregisteredType)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"nope","value":1}`), &e); !errors.Is(err, store.ErrUnregisteredType) {
+		t.Fatalf("unregistered unmarshal: got %v, want %v", err, store.ErrUnregisteredType)
+	}
+	var v store.Value
+	v.Store(1)
+	if err := json.Unmarshal([]byte(`{"type":"string","value":"x"}`), &v); !errors.Is(err, store.ErrInconsistentType) {
+		t.Fatalf("inconsistent unmarshal: got %v, want %v", err, store.ErrInconsistentType)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("registering a name twice should panic")
+			}
+		}()
+		store.RegisterType("endpoint", 0)
+	}()
+}
+
+func TestMarshalText(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tt := range []struct {
+		val  any
+		text string
+	}{
+		{"a:b", "string:a:b"},
+		{42, "int:42"},
+		{now, "time.Time:2024-01-02T03:04:05Z"},
+		{endpoint{"h", 1}, `endpoint:{"Host":"h","Port":1}`},
+		{nil, ""},
+	} {
+		var e store.Entry
+		e.Store(tt.val)
+		text, err := e.MarshalText()
+		if err != nil || string(text) != tt.text {
+			t.Fatalf("MarshalText(%v): got %q %v, want %q", tt.val, text, err, tt.text)
+		}
+		var d store.Entry
+		if err := d.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Load(); got != tt.val {
+			t.Fatal(fmtfn("UnmarshalText", got, tt.val))
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	var c config
+	c.Name.Store("api")
+	c.Target.Store(endpoint{"localhost", 80})
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&c); err != nil {
+		t.Fatal(err)
+	}
+	var d config
+	if err := gob.NewDecoder(&buf).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Name.Load() != "api" || d.Target.Load() != (endpoint{"localhost", 80}) || d.Timeout.Load() != nil {
+		t.Fatalf("gob: got %v %v %v", d.Name.Load(), d.Target.Load(), d.Timeout.Load())
+	}
+
+	var v store.Value
+	v.Store([]byte("raw"))
+	data, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w store.Value
+	if err := w.UnmarshalBinary(data); err != nil || !bytes.Equal(w.Load().([]byte), []byte("raw")) {
+		t.Fatalf("binary: got %v %v", w.Load(), err)
+	}
+	if err := w.UnmarshalBinary(data[:3]); err == nil {
+		t.Fatal("truncated binary value should fail")
+	}
+}
@@ -0,0 +1,224 @@
+package persistent
+
+import "math/bits"
+
+// A Map is an immutable hash array mapped trie.
+// Keys must be comparable, an unhashable key panics.
+type Map[K comparable, V any] struct {
+	n    int
+	root *mapNode[K, V]
+}
+
+// mapNode holds one slot per set bit of bitmap.
+type mapNode[K comparable, V any] struct {
+	bitmap uint32
+	slots  []mapSlot[K, V]
+}
+
+// mapSlot is either a sub-node or a leaf.
+type mapSlot[K comparable, V any] struct {
+	node *mapNode[K, V]
+	leaf *mapLeaf[K, V]
+}
+
+// mapLeaf holds the entries of a single hash.
+type mapLeaf[K comparable, V any] struct {
+	hash    uint64
+	entries []mapEntry[K, V]
+}
+
+type mapEntry[K comparable, V any] struct {
+	key K
+	val V
+}
+
+func index(bitmap, bit uint32) int {
+	return bits.OnesCount32(bitmap & (bit - 1))
+}
+
+// Len returns the number of keys in m.
+func (m *Map[K, V]) Len() int {
+	if m == nil {
+		return 0
+	}
+	return m.n
+}
+
+// Get returns the value stored for key.
+// The ok result indicates whether value was found.
+func (m *Map[K, V]) Get(key K) (value V, ok bool) {
+	if m == nil || m.root == nil {
+		return value, false
+	}
+	h := hashOf(key)
+	n := m.root
+	for shift := uint(0); ; shift += levelBits {
+		bit := uint32(1) << ((h >> shift) & mask)
+		if n.bitmap&bit == 0 {
+			return value, false
+		}
+		s := &n.slots[index(n.bitmap, bit)]
+		if s.node != nil {
+			n = s.node
+			continue
+		}
+		if s.leaf.hash == h {
+			for _, e := range s.leaf.entries {
+				if e.key == key {
+					return e.val, true
+				}
+			}
+		}
+		return value, false
+	}
+}
+
+// With returns a version of m in which key maps to value.
+func (m *Map[K, V]) With(key K, value V) *Map[K, V] {
+	var root *mapNode[K, V]
+	n := 0
+	if m != nil {
+		root, n = m.root, m.n
+	}
+	if root == nil {
+		root = &mapNode[K, V]{}
+	}
+	root, added := root.with(0, hashOf(key), key, value)
+	if added {
+		n++
+	}
+	return &Map[K, V]{n: n, root: root}
+}
+
+// Without returns a version of m without key.
+// It returns m itself if key is not present.
+func (m *Map[K, V]) Without(key K) *Map[K, V] {
+	if m == nil || m.root == nil {
+		return m
+	}
+	root, removed := m.root.without(0, hashOf(key), key)
+	if !removed {
+		return m
+	}
+	if m.n == 1 {
+		return nil
+	}
+	return &Map[K, V]{n: m.n - 1, root: root}
+}
+
+// Range calls f for each key and value, stopping if f returns false.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	if m != nil && m.root != nil {
+		m.root.rangeEntries(f)
+	}
+}
+
+func (n *mapNode[K, V]) rangeEntries(f func(key K, value V) bool) bool {
+	for i := range n.slots {
+		s := &n.slots[i]
+		if s.node != nil {
+			if !s.node.rangeEntries(f) {
+				return false
+			}
+			continue
+		}
+		for _, e := range s.leaf.entries {
+			if !f(e.key, e.val) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// set returns a copy of n with the slot of bit set to s.
+func (n *mapNode[K, V]) set(bit uint32, s mapSlot[K, V]) *mapNode[K, V] {
+	i := index(n.bitmap, bit)
+	if n.bitmap&bit != 0 {
+		slots := append([]mapSlot[K, V](nil), n.slots...)
+		slots[i] = s
+		return &mapNode[K, V]{bitmap: n.bitmap, slots: slots}
+	}
+	slots := make([]mapSlot[K, V], len(n.slots)+1)
+	copy(slots, n.slots[:i])
+	slots[i] = s
+	copy(slots[i+1:], n.slots[i:])
+	return &mapNode[K, V]{bitmap: n.bitmap | bit, slots: slots}
+}
+
+// unset returns a copy of n without the slot of bit.
+func (n *mapNode[K, V]) unset(bit uint32) *mapNode[K, V] {
+	i := index(n.bitmap, bit)
+	slots := make([]mapSlot[K, V], 0, len(n.slots)-1)
+	slots = append(append(slots, n.slots[:i]...), n.slots[i+1:]...)
+	return &mapNode[K, V]{bitmap: n.bitmap &^ bit, slots: slots}
+}
+
+func leafSlot[K comparable, V any](h uint64, entries []mapEntry[K, V]) mapSlot[K, V] {
+	return mapSlot[K, V]{leaf: &mapLeaf[K, V]{hash: h, entries: entries}}
+}
+
+func (n *mapNode[K, V]) with(shift uint, h uint64, key K, value V) (*mapNode[K, V], bool) {
+	bit := uint32(1) << ((h >> shift) & mask)
+	if n.bitmap&bit == 0 {
+		return n.set(bit, leafSlot(h, []mapEntry[K, V]{{key, value}})), true
+	}
+	s := n.slots[index(n.bitmap, bit)]
+	switch {
+	case s.node != nil:
+		child, added := s.node.with(shift+levelBits, h, key, value)
+		return n.set(bit, mapSlot[K, V]{node: child}), added
+	case s.leaf.hash == h:
+		for i, e := range s.leaf.entries {
+			if e.key == key {
+				entries := append([]mapEntry[K, V](nil), s.leaf.entries...)
+				entries[i].val = value
+				return n.set(bit, leafSlot(h, entries)), false
+			}
+		}
+		entries := make([]mapEntry[K, V], len(s.leaf.entries), len(s.leaf.entries)+1)
+		copy(entries, s.leaf.entries)
+		entries = append(entries, mapEntry[K, V]{key, value})
+		return n.set(bit, leafSlot(h, entries)), true
+	default:
+		// Two hashes share this slot, push the old one a level down.
+		child := (&mapNode[K, V]{}).set(uint32(1)<<((s.leaf.hash>>(shift+levelBits))&mask), s)
+		child, _ = child.with(shift+levelBits, h, key, value)
+		return n.set(bit, mapSlot[K, V]{node: child}), true
+	}
+}
+
+func (n *mapNode[K, V]) without(shift uint, h uint64, key K) (*mapNode[K, V], bool) {
+	bit := uint32(1) << ((h >> shift) & mask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	s := n.slots[index(n.bitmap, bit)]
+	if s.node != nil {
+		child, removed := s.node.without(shift+levelBits, h, key)
+		switch {
+		case !removed:
+			return n, false
+		case len(child.slots) == 0:
+			return n.unset(bit), true
+		case len(child.slots) == 1 && child.slots[0].leaf != nil:
+			// Lift a lone leaf back up.
+			return n.set(bit, child.slots[0]), true
+		}
+		return n.set(bit, mapSlot[K, V]{node: child}), true
+	}
+	if s.leaf.hash != h {
+		return n, false
+	}
+	for i, e := range s.leaf.entries {
+		if e.key == key {
+			if len(s.leaf.entries) == 1 {
+				return n.unset(bit), true
+			}
+			entries := make([]mapEntry[K, V], 0, len(s.leaf.entries)-1)
+			entries = append(append(entries, s.leaf.entries[:i]...), s.leaf.entries[i+1:]...)
+			return n.set(bit, leafSlot(h, entries)), true
+		}
+	}
+	return n, false
+}
@@ -0,0 +1,114 @@
+package persistent_test
+
+import (
+	"math/rand"
+	"store"
+	"store/persistent"
+	"sync"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	var m *persistent.Map[string, int]
+	if _, ok := m.Get("foo"); ok || m.Len() != 0 {
+		t.Fatal("nil Map is not empty")
+	}
+	m1 := m.With("foo", 1)
+	m2 := m1.With("bar", 2).With("foo", 3)
+	if v, ok := m1.Get("foo"); v != 1 || !ok || m1.Len() != 1 {
+		t.Fatalf("old version changed: got %v %v len %d, want 1 true len 1", v, ok, m1.Len())
+	}
+	if v, ok := m2.Get("foo"); v != 3 || !ok || m2.Len() != 2 {
+		t.Fatalf("Get: got %v %v len %d, want 3 true len 2", v, ok, m2.Len())
+	}
+	if m2.Without("baz") != m2 {
+		t.Fatal("Without of a missing key should return the same version")
+	}
+	m3 := m2.Without("foo")
+	if _, ok := m3.Get("foo"); ok || m3.Len() != 1 {
+		t.Fatal("Without did not remove the key")
+	}
+	if m3.Without("bar") != nil {
+		t.Fatal("Without of the last key should return the empty map")
+	}
+}
+
+func TestMapMatchesReference(t *testing.T) {
+	var m *persistent.Map[int, int]
+	ref := map[int]int{}
+	versions := []*persistent.Map[int, int]{}
+	refs := []map[int]int{}
+	r := rand.New(rand.NewSource(1))
+	n := 20000
+	if testing.Short() {
+		n = 2000
+	}
+	for i := 0; i < n; i++ {
+		k := r.Intn(n / 2)
+		if r.Intn(3) == 0 {
+			m = m.Without(k)
+			delete(ref, k)
+		} else {
+			m = m.With(k, i)
+			ref[k] = i
+		}
+		if i%(n/10) == 0 {
+			snap := make(map[int]int, len(ref))
+			for k, v := range ref {
+				snap[k] = v
+			}
+			versions, refs = append(versions, m), append(refs, snap)
+		}
+	}
+	versions, refs = append(versions, m), append(refs, ref)
+	for i, v := range versions {
+		if v.Len() != len(refs[i]) {
+			t.Fatalf("version %d: got len %d, want %d", i, v.Len(), len(refs[i]))
+		}
+		seen := 0
+		v.Range(func(key, value int) bool {
+			seen++
+			if want, ok := refs[i][key]; !ok || want != value {
+				t.Fatalf("version %d: got %v=%v, want %v %v", i, key, value, want, ok)
+			}
+			return true
+		})
+		if seen != len(refs[i]) {
+			t.Fatalf("version %d: Range saw %d keys, want %d", i, seen, len(refs[i]))
+		}
+	}
+}
+
+func TestMapPublish(t *testing.T) {
+	var v store.Value
+	var w sync.WaitGroup
+	p, n := 8, 100
+	for i := 0; i < p; i++ {
+		i := i
+		w.Add(1)
+		go func() {
+			for j := 0; j < n; j++ {
+				v.Update(func(old any) (any, bool) {
+					m, _ := old.(*persistent.Map[int, int])
+					return m.With(i*n+j, j), true
+				})
+			}
+			w.Done()
+		}()
+	}
+	w.Wait()
+	if m := v.Load().(*persistent.Map[int, int]); m.Len() != p*n {
+		t.Fatalf("got len %d, want %d", m.Len(), p*n)
+	}
+}
+
+func BenchmarkMapWith(b *testing.B) {
+	var m *persistent.Map[int, int]
+	for i := 0; i < 1<<16; i++ {
+		m = m.With(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.With(i&0xffff, i)
+	}
+}
@@ -0,0 +1,31 @@
+// Package persistent provides immutable data structures whose updates
+// return a new version sharing most of its structure with the old one.
+//
+// An update costs O(log n) time and memory, so a large map or vector
+// can be published through store.Value.CompareAndSwap without copying
+// it whole. A nil *Map or *Vector is empty and ready for use, and
+// versions are compared by pointer.
+package persistent
+
+import (
+	"hash/maphash"
+	"unsafe"
+)
+
+const (
+	levelBits = 5
+	width     = 1 << levelBits
+	mask      = width - 1
+)
+
+var seed = func() uintptr {
+	var h maphash.Hash
+	return uintptr(h.Sum64())
+}()
+
+func hashOf(key any) uint64 {
+	return uint64(runtime_nilinterhash(unsafe.Pointer(&key), seed))
+}
+
+//go:linkname runtime_nilinterhash runtime.nilinterhash
+func runtime_nilinterhash(p unsafe.Pointer, h uintptr) uintptr
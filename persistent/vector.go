@@ -0,0 +1,147 @@
+package persistent
+
+// A Vector is an immutable bit-partitioned vector trie.
+type Vector[T any] struct {
+	n     int
+	shift uint // of the root, 0 when the root is a leaf
+	root  *vecNode[T]
+}
+
+// vecNode is a leaf holding values, or an inner node.
+type vecNode[T any] struct {
+	kids []*vecNode[T]
+	vals []T
+}
+
+// Len returns the number of values in v.
+func (v *Vector[T]) Len() int {
+	if v == nil {
+		return 0
+	}
+	return v.n
+}
+
+// At returns the value at index i. It panics if i is out of range.
+func (v *Vector[T]) At(i int) T {
+	if i < 0 || i >= v.Len() {
+		panic("persistent: index out of range")
+	}
+	n := v.root
+	for shift := v.shift; shift > 0; shift -= levelBits {
+		n = n.kids[(i>>shift)&mask]
+	}
+	return n.vals[i&mask]
+}
+
+// Set returns a version of v with the value at index i set to val.
+// It panics if i is out of range.
+func (v *Vector[T]) Set(i int, val T) *Vector[T] {
+	if i < 0 || i >= v.Len() {
+		panic("persistent: index out of range")
+	}
+	return &Vector[T]{n: v.n, shift: v.shift, root: v.root.set(v.shift, i, val)}
+}
+
+// Append returns a version of v with val appended.
+func (v *Vector[T]) Append(val T) *Vector[T] {
+	if v == nil || v.root == nil {
+		return &Vector[T]{n: 1, root: &vecNode[T]{vals: []T{val}}}
+	}
+	root, shift := v.root, v.shift
+	if v.n == 1<<(shift+levelBits) {
+		// The trie is full, grow a level.
+		root = &vecNode[T]{kids: []*vecNode[T]{root}}
+		shift += levelBits
+	}
+	return &Vector[T]{n: v.n + 1, shift: shift, root: root.set(shift, v.n, val)}
+}
+
+// Pop returns a version of v without its last value.
+// It panics if v is empty.
+func (v *Vector[T]) Pop() *Vector[T] {
+	switch v.Len() {
+	case 0:
+		panic("persistent: Pop of empty vector")
+	case 1:
+		return nil
+	}
+	root, shift := v.root.pop(v.shift, v.n-1), v.shift
+	if shift > 0 && len(root.kids) == 1 {
+		// Drop a level that holds a single child.
+		root, shift = root.kids[0], shift-levelBits
+	}
+	return &Vector[T]{n: v.n - 1, shift: shift, root: root}
+}
+
+// Range calls f for each index and value in order,
+// stopping if f returns false.
+func (v *Vector[T]) Range(f func(i int, val T) bool) {
+	if v != nil && v.root != nil {
+		v.root.rangeVals(v.shift, 0, f)
+	}
+}
+
+func (n *vecNode[T]) rangeVals(shift uint, base int, f func(i int, val T) bool) bool {
+	if shift == 0 {
+		for i, val := range n.vals {
+			if !f(base+i, val) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, kid := range n.kids {
+		if !kid.rangeVals(shift-levelBits, base+i<<shift, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// set returns a copy of n, nil for a new node, with index i set to val.
+// i may be one past the last index.
+func (n *vecNode[T]) set(shift uint, i int, val T) *vecNode[T] {
+	j := (i >> shift) & mask
+	if shift == 0 {
+		var vals []T
+		if n != nil {
+			vals = append(vals, n.vals...)
+		}
+		if j == len(vals) {
+			vals = append(vals, val)
+		} else {
+			vals[j] = val
+		}
+		return &vecNode[T]{vals: vals}
+	}
+	var kids []*vecNode[T]
+	if n != nil {
+		kids = append(kids, n.kids...)
+	}
+	if j == len(kids) {
+		kids = append(kids, nil)
+	}
+	kids[j] = kids[j].set(shift-levelBits, i, val)
+	return &vecNode[T]{kids: kids}
+}
+
+// pop returns a copy of n without index i, the last one,
+// or nil if that leaves n empty.
+func (n *vecNode[T]) pop(shift uint, i int) *vecNode[T] {
+	j := (i >> shift) & mask
+	if shift == 0 {
+		if j == 0 {
+			return nil
+		}
+		return &vecNode[T]{vals: n.vals[:j:j]}
+	}
+	kid := n.kids[j].pop(shift-levelBits, i)
+	if kid == nil && j == 0 {
+		return nil
+	}
+	kids := append([]*vecNode[T](nil), n.kids[:j]...)
+	if kid != nil {
+		kids = append(kids, kid)
+	}
+	return &vecNode[T]{kids: kids}
+}
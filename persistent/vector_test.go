@@ -0,0 +1,69 @@
+package persistent_test
+
+import (
+	"store/persistent"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	var v *persistent.Vector[int]
+	if v.Len() != 0 {
+		t.Fatal("nil Vector is not empty")
+	}
+	n := 5000
+	versions := []*persistent.Vector[int]{}
+	for i := 0; i < n; i++ {
+		v = v.Append(i)
+		versions = append(versions, v)
+	}
+	for i, ver := range versions {
+		if ver.Len() != i+1 || ver.At(i) != i || ver.At(0) != 0 {
+			t.Fatalf("version %d: len %d, last %d", i, ver.Len(), ver.At(i))
+		}
+	}
+	w := v.Set(1234, -1)
+	if v.At(1234) != 1234 || w.At(1234) != -1 || w.Len() != n {
+		t.Fatal("Set changed the old version or missed the new one")
+	}
+	next := 0
+	w.Range(func(i, val int) bool {
+		if i != next || (val != i && i != 1234) {
+			t.Fatalf("Range: got %d=%d at step %d", i, val, next)
+		}
+		next++
+		return true
+	})
+	if next != n {
+		t.Fatalf("Range: saw %d values, want %d", next, n)
+	}
+	for i := n - 1; i >= 0; i-- {
+		if v.Len() != i+1 || v.At(i) != i {
+			t.Fatalf("Pop: got len %d, want %d", v.Len(), i+1)
+		}
+		v = v.Pop()
+	}
+	if v != nil {
+		t.Fatal("Pop of the last value should return the empty vector")
+	}
+	if versions[n-1].At(n-1) != n-1 {
+		t.Fatal("Pop changed an old version")
+	}
+}
+
+func TestVectorOutOfRange(t *testing.T) {
+	v := (*persistent.Vector[int])(nil).Append(1)
+	for name, f := range map[string]func(){
+		"At":  func() { v.At(1) },
+		"Set": func() { v.Set(-1, 0) },
+		"Pop": func() { v.Pop().Pop() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s out of range should panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
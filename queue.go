@@ -0,0 +1,94 @@
+package store
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Queue is a lock-free multi-producer multi-consumer FIFO queue,
+// a Michael-Scott queue. Values of mixed types and nil values may be
+// enqueued.
+//
+// Every Enqueue allocates a new node, and the garbage collector does
+// not reuse a node while a Dequeue still holds it, so the pointer
+// compare-and-swap is not subject to the ABA problem.
+//
+// The zero Queue is empty and ready for use.
+type Queue struct {
+	n    int64
+	head unsafe.Pointer // *queueNode, a dummy node
+	tail unsafe.Pointer // *queueNode, the last node or the one before
+}
+
+type queueNode struct {
+	val  any
+	next unsafe.Pointer // *queueNode
+}
+
+// init installs the first dummy node.
+func (q *Queue) init() {
+	if atomic.LoadPointer(&q.tail) != nil {
+		return
+	}
+	atomic.CompareAndSwapPointer(&q.head, nil, unsafe.Pointer(&queueNode{}))
+	atomic.CompareAndSwapPointer(&q.tail, nil, atomic.LoadPointer(&q.head))
+}
+
+// Enqueue adds val to the back of the queue.
+func (q *Queue) Enqueue(val any) {
+	q.init()
+	n := unsafe.Pointer(&queueNode{val: val})
+	for {
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&(*queueNode)(tail).next)
+		if tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+		if next != nil {
+			// Tail is lagging behind, help it along.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			continue
+		}
+		if atomic.CompareAndSwapPointer(&(*queueNode)(tail).next, nil, n) {
+			atomic.CompareAndSwapPointer(&q.tail, tail, n)
+			atomic.AddInt64(&q.n, 1)
+			return
+		}
+	}
+}
+
+// Dequeue removes and returns the value at the front of the queue.
+// The ok result reports whether the queue was not empty.
+func (q *Queue) Dequeue() (val any, ok bool) {
+	q.init()
+	for {
+		head := atomic.LoadPointer(&q.head)
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&(*queueNode)(head).next)
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+		if next == nil {
+			return nil, false
+		}
+		if head == tail {
+			// Tail is lagging behind, help it along.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			continue
+		}
+		val = (*queueNode)(next).val
+		if atomic.CompareAndSwapPointer(&q.head, head, next) {
+			atomic.AddInt64(&q.n, -1)
+			return val, true
+		}
+	}
+}
+
+// Len returns the number of values in the queue.
+// Under concurrent use it is only an estimate.
+func (q *Queue) Len() int {
+	if n := atomic.LoadInt64(&q.n); n > 0 {
+		return int(n)
+	}
+	return 0
+}
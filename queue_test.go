@@ -0,0 +1,96 @@
+package store_test
+
+import (
+	"runtime"
+	"store"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	var q store.Queue
+	if v, ok := q.Dequeue(); v != nil || ok {
+		t.Fatalf("Dequeue on empty: got %v %v, want nil false", v, ok)
+	}
+	q.Enqueue(1)
+	q.Enqueue(nil)
+	q.Enqueue("foo")
+	if q.Len() != 3 {
+		t.Fatal(fmtfn("len", q.Len(), 3))
+	}
+	for _, want := range []any{1, nil, "foo"} {
+		if v, ok := q.Dequeue(); v != want || !ok {
+			t.Fatalf("Dequeue: got %v %v, want %v true", v, ok, want)
+		}
+	}
+	if _, ok := q.Dequeue(); ok || q.Len() != 0 {
+		t.Fatal("queue not empty after dequeuing everything")
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	var q store.Queue
+	var count uint64
+	var g sync.WaitGroup
+	var m, n uint64 = 100, 1000
+	if testing.Short() {
+		m = 10
+		n = 100
+	}
+	for i := uint64(0); i < m*n; i += n {
+		i := i
+		g.Add(2)
+		go func() {
+			for v := i; v < i+n; v++ {
+				q.Enqueue(v)
+			}
+			g.Done()
+		}()
+		go func() {
+			var c uint64
+			for got := uint64(0); got < n; {
+				if v, ok := q.Dequeue(); ok {
+					c += v.(uint64)
+					got++
+				} else {
+					runtime.Gosched()
+				}
+			}
+			atomic.AddUint64(&count, c)
+			g.Done()
+		}()
+	}
+	g.Wait()
+	if want := (m*n - 1) * (m * n) / 2; count != want {
+		t.Errorf("sum from 0 to %d was %d, want %v", m*n-1, count, want)
+	}
+	if q.Len() != 0 {
+		t.Fatal(fmtfn("len", q.Len(), 0))
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	// Values from a single producer come out in order.
+	var q store.Queue
+	n := 10000
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Enqueue(i)
+		}
+		close(done)
+	}()
+	for want := 0; want < n; {
+		v, ok := q.Dequeue()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		if v != want {
+			t.Fatal(fmtfn("dequeue", v, want))
+		}
+		want++
+	}
+	<-done
+}
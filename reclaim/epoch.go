@@ -0,0 +1,93 @@
+package reclaim
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Epochs is an epoch-based reclamation domain.
+//
+// A global epoch only advances once every reader inside a critical
+// section has seen the current one. A value unlinked and retired
+// during epoch e is therefore unreachable by the time the epoch
+// reaches e+2, and its release function runs then.
+//
+// The zero Epochs is ready for use.
+type Epochs struct {
+	epoch   uint64
+	readers records[uint64] // epoch<<1 | 1 while in a critical section
+	mu      sync.Mutex
+	limbo   []retired
+}
+
+type retired struct {
+	epoch   uint64
+	release func()
+}
+
+// A Guard is a critical section of an Epochs. Values loaded inside it
+// stay valid until Exit, which must be called exactly once.
+type Guard struct {
+	r *record[uint64]
+}
+
+// Enter enters a critical section.
+func (e *Epochs) Enter() Guard {
+	r := e.readers.acquire()
+	atomic.StoreUint64(&r.r, atomic.LoadUint64(&e.epoch)<<1|1)
+	return Guard{r}
+}
+
+// Exit leaves the critical section.
+func (g Guard) Exit() {
+	atomic.StoreUint64(&g.r.r, 0)
+	g.r.release()
+}
+
+// Retire calls release once no reader can still see the value it
+// retires, which must already be unlinked. release may run before
+// Retire returns, on whichever goroutine advances the epoch.
+func (e *Epochs) Retire(release func()) {
+	e.mu.Lock()
+	e.limbo = append(e.limbo, retired{atomic.LoadUint64(&e.epoch), release})
+	e.mu.Unlock()
+	e.Flush()
+}
+
+// Flush advances the epoch as far as readers allow and runs the
+// release functions that became safe, returning how many it ran.
+func (e *Epochs) Flush() int {
+	for i := 0; i < 2 && e.advance(); i++ {
+	}
+	epoch := atomic.LoadUint64(&e.epoch)
+	e.mu.Lock()
+	var ready []retired
+	keep := e.limbo[:0]
+	for _, r := range e.limbo {
+		if r.epoch+2 <= epoch {
+			ready = append(ready, r)
+		} else {
+			keep = append(keep, r)
+		}
+	}
+	for i := len(keep); i < len(e.limbo); i++ {
+		e.limbo[i] = retired{}
+	}
+	e.limbo = keep
+	e.mu.Unlock()
+	for _, r := range ready {
+		r.release()
+	}
+	return len(ready)
+}
+
+// advance moves the epoch on if every reader has seen it.
+func (e *Epochs) advance() bool {
+	epoch := atomic.LoadUint64(&e.epoch)
+	for r := e.readers.first(); r != nil; r = r.next {
+		if s := atomic.LoadUint64(&r.r); s&1 != 0 && s>>1 != epoch {
+			return false
+		}
+	}
+	return atomic.CompareAndSwapUint64(&e.epoch, epoch, epoch+1)
+}
@@ -0,0 +1,95 @@
+package reclaim_test
+
+import (
+	"runtime"
+	"store"
+	"store/reclaim"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// resource stands for a value wrapping a pooled resource.
+type resource struct {
+	freed int32
+}
+
+func (r *resource) release() {
+	if !atomic.CompareAndSwapInt32(&r.freed, 0, 1) {
+		panic("resource released twice")
+	}
+}
+
+func (r *resource) use() bool {
+	return atomic.LoadInt32(&r.freed) == 0
+}
+
+func TestEpochs(t *testing.T) {
+	var e reclaim.Epochs
+	r := &resource{}
+	e.Retire(r.release)
+	if r.use() {
+		t.Fatal("retired value not released without readers")
+	}
+
+	g := e.Enter()
+	r = &resource{}
+	e.Retire(r.release)
+	if n := e.Flush(); n != 0 || !r.use() {
+		t.Fatalf("released %v values while a reader may see them", n)
+	}
+	g.Exit()
+	if n := e.Flush(); n != 1 || r.use() {
+		t.Fatalf("after Exit: released %v values, want 1", n)
+	}
+}
+
+func TestEpochsConcurrent(t *testing.T) {
+	var e reclaim.Epochs
+	testReclaim(t, func(v *store.Entry) (*resource, func()) {
+		g := e.Enter()
+		return v.Load().(*resource), g.Exit
+	}, func(v *store.Entry, r *resource) {
+		old := v.Swap(r).(*resource)
+		e.Retire(old.release)
+	})
+	for e.Flush() > 0 {
+	}
+}
+
+// testReclaim replaces the resource in an Entry while readers use it,
+// failing if a reader sees a released one.
+func testReclaim(t *testing.T, load func(v *store.Entry) (*resource, func()), replace func(v *store.Entry, r *resource)) {
+	var v store.Entry
+	v.Store(&resource{})
+	p := runtime.GOMAXPROCS(0)
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	var w sync.WaitGroup
+	for i := 0; i < p; i++ {
+		w.Add(2)
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				replace(&v, &resource{})
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				r, done := load(&v)
+				ok := r.use()
+				runtime.Gosched()
+				ok = ok && r.use()
+				done()
+				if !ok {
+					t.Error("reader saw a released resource")
+					return
+				}
+			}
+		}()
+	}
+	w.Wait()
+}
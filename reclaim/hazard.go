@@ -0,0 +1,119 @@
+package reclaim
+
+import (
+	"store"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Hazards is a hazard pointer domain over the value pointers of
+// store.Entry, as returned by Entry.Ptr. Every Store to an Entry
+// allocates a new value pointer, so a pointer names one stored value.
+// Writers replace it with Entry.SwapPtr or Entry.CompareAndSwapPtr,
+// which tell them the exact pointer to retire.
+//
+// A retired pointer is released once no Hazard protects it. Retired
+// pointers are scanned in batches, so at most about twice as many as
+// there are hazards wait at a time.
+//
+// The zero Hazards is ready for use.
+type Hazards struct {
+	hazards records[unsafe.Pointer]
+	mu      sync.Mutex
+	retired []retiredPtr
+}
+
+type retiredPtr struct {
+	p       unsafe.Pointer
+	release func()
+}
+
+// A Hazard protects one value pointer until Release,
+// which must be called exactly once.
+type Hazard struct {
+	r *record[unsafe.Pointer]
+}
+
+// Protect protects the current value of e and returns a Hazard
+// holding it.
+func (h *Hazards) Protect(e *store.Entry) Hazard {
+	r := h.hazards.acquire()
+	p := e.Ptr()
+	for {
+		atomic.StorePointer(&r.r, p)
+		// The value may have been replaced, and even retired, before
+		// it was protected: only once it is seen again is it safe.
+		q := e.Ptr()
+		if q == p {
+			return Hazard{r}
+		}
+		p = q
+	}
+}
+
+// Ptr returns the protected value pointer, nil if the Entry was empty.
+func (hz Hazard) Ptr() unsafe.Pointer {
+	return atomic.LoadPointer(&hz.r.r)
+}
+
+// Load returns the protected value.
+func (hz Hazard) Load() (val any) {
+	if p := hz.Ptr(); p != nil {
+		return *(*any)(p)
+	}
+	return nil
+}
+
+// Release ends the protection.
+func (hz Hazard) Release() {
+	atomic.StorePointer(&hz.r.r, nil)
+	hz.r.release()
+}
+
+// Retire calls release once p, a value pointer already replaced in
+// its Entry, is no longer protected. p is the pointer returned by
+// Entry.SwapPtr, or passed to a successful Entry.CompareAndSwapPtr:
+// another pointer to an equal value would not be the one readers hold. release may run before Retire
+// returns, on whichever goroutine scans.
+func (h *Hazards) Retire(p unsafe.Pointer, release func()) {
+	h.mu.Lock()
+	h.retired = append(h.retired, retiredPtr{p, release})
+	n := len(h.retired)
+	h.mu.Unlock()
+	if n >= 2*h.hazards.len()+16 {
+		h.Scan()
+	}
+}
+
+// Scan runs the release functions of the retired pointers that are
+// not protected, returning how many it ran.
+func (h *Hazards) Scan() int {
+	h.mu.Lock()
+	candidates := h.retired
+	h.retired = nil
+	h.mu.Unlock()
+
+	protected := make(map[unsafe.Pointer]bool)
+	for r := h.hazards.first(); r != nil; r = r.next {
+		if p := atomic.LoadPointer(&r.r); p != nil {
+			protected[p] = true
+		}
+	}
+	var keep []retiredPtr
+	n := 0
+	for _, r := range candidates {
+		if protected[r.p] {
+			keep = append(keep, r)
+			continue
+		}
+		r.release()
+		n++
+	}
+	if len(keep) > 0 {
+		h.mu.Lock()
+		h.retired = append(h.retired, keep...)
+		h.mu.Unlock()
+	}
+	return n
+}
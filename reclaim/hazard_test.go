@@ -0,0 +1,52 @@
+package reclaim_test
+
+import (
+	"store"
+	"store/reclaim"
+	"testing"
+)
+
+func TestHazards(t *testing.T) {
+	var h reclaim.Hazards
+	var v store.Entry
+	r := &resource{}
+	v.Store(r)
+	hz := h.Protect(&v)
+	if hz.Load() != r || hz.Ptr() != v.Ptr() {
+		t.Fatalf("Protect: got %v, want %v", hz.Load(), r)
+	}
+	p := v.SwapPtr(&resource{})
+	h.Retire(p, r.release)
+	if n := h.Scan(); n != 0 || !r.use() {
+		t.Fatalf("released %v protected values", n)
+	}
+	hz.Release()
+	if n := h.Scan(); n != 1 || r.use() {
+		t.Fatalf("after Release: released %v values, want 1", n)
+	}
+
+	var empty store.Entry
+	hz = h.Protect(&empty)
+	if hz.Load() != nil || hz.Ptr() != nil {
+		t.Fatalf("Protect of empty Entry: got %v", hz.Load())
+	}
+	hz.Release()
+}
+
+func TestHazardsConcurrent(t *testing.T) {
+	var h reclaim.Hazards
+	testReclaim(t, func(v *store.Entry) (*resource, func()) {
+		hz := h.Protect(v)
+		return hz.Load().(*resource), hz.Release
+	}, func(v *store.Entry, r *resource) {
+		// Each writer must retire the exact pointer it replaced.
+		for {
+			p := v.Ptr()
+			if v.CompareAndSwapPtr(p, r) {
+				h.Retire(p, (*(*any)(p)).(*resource).release)
+				return
+			}
+		}
+	})
+	h.Scan()
+}
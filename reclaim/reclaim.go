@@ -0,0 +1,90 @@
+// Package reclaim provides safe memory reclamation for lock-free
+// structures built on store.Entry, whose values may wrap pooled or
+// off-heap resources that must not be released while a reader can
+// still reach them.
+//
+// Epochs is epoch-based reclamation: readers bracket their accesses
+// with Enter and Exit, and a retired value is released once every
+// reader that might have seen it has exited. It is cheap for readers
+// but one stalled reader delays every release.
+//
+// Hazards is hazard pointers: a reader protects the single value it
+// uses, and only the values actually protected are held back.
+//
+// The package level functions use default domains.
+package reclaim
+
+import (
+	"store"
+	"sync/atomic"
+	"unsafe"
+)
+
+var (
+	defaultEpochs  Epochs
+	defaultHazards Hazards
+)
+
+// Enter enters a critical section of the default Epochs.
+func Enter() Guard {
+	return defaultEpochs.Enter()
+}
+
+// Retire calls release on the default Epochs once no reader can still
+// see the value it retires.
+func Retire(release func()) {
+	defaultEpochs.Retire(release)
+}
+
+// Protect protects the current value of e with the default Hazards.
+func Protect(e *store.Entry) Hazard {
+	return defaultHazards.Protect(e)
+}
+
+// RetirePtr calls release on the default Hazards once p, a value
+// pointer of an Entry, is no longer protected.
+func RetirePtr(p unsafe.Pointer, release func()) {
+	defaultHazards.Retire(p, release)
+}
+
+// records is a grow-only lock-free list of per-reader records, which
+// are reused rather than freed so that scanning them is always safe.
+type records[R any] struct {
+	head unsafe.Pointer // *record[R]
+	n    int32
+}
+
+type record[R any] struct {
+	r     R
+	inUse int32
+	next  *record[R] // set before the record is published
+}
+
+// acquire returns a record no one else uses.
+func (l *records[R]) acquire() *record[R] {
+	for r := l.first(); r != nil; r = r.next {
+		if atomic.LoadInt32(&r.inUse) == 0 && atomic.CompareAndSwapInt32(&r.inUse, 0, 1) {
+			return r
+		}
+	}
+	r := &record[R]{inUse: 1}
+	for {
+		r.next = l.first()
+		if atomic.CompareAndSwapPointer(&l.head, unsafe.Pointer(r.next), unsafe.Pointer(r)) {
+			atomic.AddInt32(&l.n, 1)
+			return r
+		}
+	}
+}
+
+func (r *record[R]) release() {
+	atomic.StoreInt32(&r.inUse, 0)
+}
+
+func (l *records[R]) first() *record[R] {
+	return (*record[R])(atomic.LoadPointer(&l.head))
+}
+
+func (l *records[R]) len() int {
+	return int(atomic.LoadInt32(&l.n))
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"io"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Resource holds a value that must be closed once it is no longer
+// used, such as a database pool or a file, and replaces it safely:
+// a replaced value is released only after every reader that acquired
+// it has let go.
+//
+// The zero Resource is empty and ready for use.
+// A Resource must not be copied after first use.
+type Resource struct {
+	// Release is called with each replaced value, on the goroutine
+	// that lets go of it last. nil means closing values that implement
+	// io.Closer and ignoring the error.
+	Release func(val any)
+
+	p unsafe.Pointer // *resourceRef
+}
+
+// resourceRef counts the references to a value, one of them held by
+// the Resource while the value is current. Once the count drops to 0
+// the value is released and the count stays 0.
+type resourceRef struct {
+	val  any
+	refs int64
+}
+
+// Acquire returns the current value, nil if there is none, holding a
+// reference to it until release is called. release must be called
+// exactly once.
+func (r *Resource) Acquire() (val any, release func()) {
+	for {
+		ref := (*resourceRef)(atomic.LoadPointer(&r.p))
+		if ref == nil {
+			return nil, func() {}
+		}
+		n := atomic.LoadInt64(&ref.refs)
+		if n <= 0 {
+			// Replaced and released meanwhile, a newer value is current.
+			continue
+		}
+		if atomic.CompareAndSwapInt64(&ref.refs, n, n+1) {
+			return ref.val, func() { r.unref(ref) }
+		}
+	}
+}
+
+// Replace makes new the current value and releases the old one once
+// its last reference is released.
+func (r *Resource) Replace(new any) {
+	r.swap(&resourceRef{val: new, refs: 1})
+}
+
+// Reset releases the current value like Replace, leaving the
+// Resource empty.
+func (r *Resource) Reset() {
+	r.swap(nil)
+}
+
+func (r *Resource) swap(ref *resourceRef) {
+	if old := (*resourceRef)(atomic.SwapPointer(&r.p, unsafe.Pointer(ref))); old != nil {
+		r.unref(old)
+	}
+}
+
+func (r *Resource) unref(ref *resourceRef) {
+	if atomic.AddInt64(&ref.refs, -1) != 0 {
+		return
+	}
+	if r.Release != nil {
+		r.Release(ref.val)
+	} else if c, ok := ref.val.(io.Closer); ok {
+		c.Close()
+	}
+}
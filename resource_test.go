@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"runtime"
+	"store"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// closer records whether it was closed.
+type closer struct {
+	closed int32
+}
+
+func (c *closer) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		panic("closed twice")
+	}
+	return nil
+}
+
+func (c *closer) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) != 0
+}
+
+func TestResource(t *testing.T) {
+	var r store.Resource
+	if v, release := r.Acquire(); v != nil {
+		t.Fatal(fmtfn("Acquire on empty", v, nil))
+	} else {
+		release()
+	}
+	a, b := &closer{}, &closer{}
+	r.Replace(a)
+	v, release := r.Acquire()
+	if v != a {
+		t.Fatal(fmtfn("Acquire", v, a))
+	}
+	r.Replace(b)
+	if a.isClosed() {
+		t.Fatal("closed a value still in use")
+	}
+	release()
+	if !a.isClosed() {
+		t.Fatal("did not close a value after its last release")
+	}
+	r.Reset()
+	if !b.isClosed() {
+		t.Fatal("Reset did not close the current value")
+	}
+	if v, _ := r.Acquire(); v != nil {
+		t.Fatal(fmtfn("Acquire after Reset", v, nil))
+	}
+
+	var released []any
+	r = store.Resource{Release: func(val any) { released = append(released, val) }}
+	r.Replace(1)
+	r.Replace(2)
+	if len(released) != 1 || released[0] != 1 {
+		t.Fatal(fmtfn("released", released, []any{1}))
+	}
+}
+
+func TestResourceConcurrent(t *testing.T) {
+	var r store.Resource
+	var all []*closer
+	var mu sync.Mutex
+	r.Replace(&closer{})
+	p := runtime.GOMAXPROCS(0)
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	var w sync.WaitGroup
+	for i := 0; i < p; i++ {
+		w.Add(2)
+		go func() {
+			defer w.Done()
+			for j := 0; j < n/10; j++ {
+				c := &closer{}
+				mu.Lock()
+				all = append(all, c)
+				mu.Unlock()
+				r.Replace(c)
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				v, release := r.Acquire()
+				if v.(*closer).isClosed() {
+					t.Error("acquired a closed value")
+				}
+				runtime.Gosched()
+				if v.(*closer).isClosed() {
+					t.Error("value closed while in use")
+				}
+				release()
+			}
+		}()
+	}
+	w.Wait()
+	r.Reset()
+	for _, c := range all {
+		if !c.isClosed() {
+			t.Fatal("a replaced value was never closed")
+		}
+	}
+}
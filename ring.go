@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// A RingMode says which goroutines may use a Ring at the same time.
+type RingMode int
+
+const (
+	// MPMC lets any number of goroutines push and pop concurrently.
+	// Every slot carries a sequence number that tells producers and
+	// consumers whose turn it is.
+	MPMC RingMode = iota
+
+	// SPSC lets one goroutine push while another one pops. It needs
+	// no compare-and-swap, only atomic loads and stores.
+	SPSC
+)
+
+// A Ring is a bounded lock-free FIFO queue of fixed capacity.
+// Values of mixed types and nil values may be pushed.
+//
+// Unlike Stack and Queue, a Ring must be created with NewRing:
+// the zero Ring has no slots, and pushing to or popping from it panics.
+type Ring struct {
+	head uint64 // next position to pop
+	_    [56]byte
+	tail uint64 // next position to push
+	_    [56]byte
+
+	mode  RingMode
+	mask  uint64
+	slots []ringSlot
+
+	notEmpty ringWaiters
+	notFull  ringWaiters
+}
+
+// ringSlot holds a value between a push and a pop. val needs no
+// atomics of its own: seq, or head and tail in SPSC mode, order the
+// write of val before its read.
+type ringSlot struct {
+	seq uint64 // MPMC only
+	val any
+}
+
+// NewRing returns an empty Ring holding up to capacity values,
+// rounded up to a power of two, at least 2.
+func NewRing(capacity int, mode RingMode) *Ring {
+	size := uint64(2)
+	for size < uint64(capacity) {
+		size <<= 1
+	}
+	r := &Ring{
+		mode:     mode,
+		mask:     size - 1,
+		slots:    make([]ringSlot, size),
+		notEmpty: ringWaiters{ch: make(chan struct{}, 1)},
+		notFull:  ringWaiters{ch: make(chan struct{}, 1)},
+	}
+	for i := range r.slots {
+		r.slots[i].seq = uint64(i)
+	}
+	return r
+}
+
+// Cap returns the capacity of the ring.
+func (r *Ring) Cap() int {
+	return len(r.slots)
+}
+
+// Len returns the number of values in the ring.
+// Under concurrent use it is only an estimate.
+func (r *Ring) Len() int {
+	head := atomic.LoadUint64(&r.head)
+	tail := atomic.LoadUint64(&r.tail)
+	if tail < head {
+		return 0
+	}
+	return int(tail - head)
+}
+
+// TryPush adds val to the back of the ring.
+// It returns false if the ring is full.
+func (r *Ring) TryPush(val any) (ok bool) {
+	if r.mode == SPSC {
+		ok = r.pushSPSC(val)
+	} else {
+		ok = r.pushMPMC(val)
+	}
+	if ok {
+		r.notEmpty.wake()
+	}
+	return ok
+}
+
+// TryPop removes and returns the value at the front of the ring.
+// The ok result is false if the ring is empty.
+func (r *Ring) TryPop() (val any, ok bool) {
+	if r.mode == SPSC {
+		val, ok = r.popSPSC()
+	} else {
+		val, ok = r.popMPMC()
+	}
+	if ok {
+		r.notFull.wake()
+	}
+	return val, ok
+}
+
+// Push adds val to the back of the ring, waiting for room
+// until ctx is done.
+func (r *Ring) Push(ctx context.Context, val any) error {
+	return r.notFull.wait(ctx, func() bool {
+		return r.TryPush(val)
+	})
+}
+
+// Pop removes and returns the value at the front of the ring,
+// waiting for one until ctx is done.
+func (r *Ring) Pop(ctx context.Context) (val any, err error) {
+	err = r.notEmpty.wait(ctx, func() (ok bool) {
+		val, ok = r.TryPop()
+		return ok
+	})
+	return val, err
+}
+
+func (r *Ring) pushSPSC(val any) bool {
+	tail := atomic.LoadUint64(&r.tail)
+	if tail-atomic.LoadUint64(&r.head) == uint64(len(r.slots)) {
+		return false
+	}
+	r.slots[tail&r.mask].val = val
+	atomic.StoreUint64(&r.tail, tail+1)
+	return true
+}
+
+func (r *Ring) popSPSC() (val any, ok bool) {
+	head := atomic.LoadUint64(&r.head)
+	if head == atomic.LoadUint64(&r.tail) {
+		return nil, false
+	}
+	slot := &r.slots[head&r.mask]
+	val, slot.val = slot.val, nil
+	atomic.StoreUint64(&r.head, head+1)
+	return val, true
+}
+
+func (r *Ring) pushMPMC(val any) bool {
+	for {
+		tail := atomic.LoadUint64(&r.tail)
+		slot := &r.slots[tail&r.mask]
+		switch d := int64(atomic.LoadUint64(&slot.seq) - tail); {
+		case d == 0:
+			if atomic.CompareAndSwapUint64(&r.tail, tail, tail+1) {
+				slot.val = val
+				atomic.StoreUint64(&slot.seq, tail+1)
+				return true
+			}
+		case d < 0:
+			// The slot still holds the value pushed a lap ago.
+			return false
+		}
+	}
+}
+
+func (r *Ring) popMPMC() (val any, ok bool) {
+	for {
+		head := atomic.LoadUint64(&r.head)
+		slot := &r.slots[head&r.mask]
+		switch d := int64(atomic.LoadUint64(&slot.seq) - (head + 1)); {
+		case d == 0:
+			if atomic.CompareAndSwapUint64(&r.head, head, head+1) {
+				val, slot.val = slot.val, nil
+				atomic.StoreUint64(&slot.seq, head+r.mask+1)
+				return val, true
+			}
+		case d < 0:
+			// The slot has not been pushed to yet.
+			return nil, false
+		}
+	}
+}
+
+// ringWaiters parks goroutines until the other side of the ring
+// makes progress. Those that make progress only pay for an atomic
+// load while nobody waits.
+type ringWaiters struct {
+	n  int32
+	ch chan struct{}
+}
+
+func (w *ringWaiters) wake() {
+	if atomic.LoadInt32(&w.n) > 0 {
+		select {
+		case w.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait calls try until it succeeds or ctx is done.
+func (w *ringWaiters) wait(ctx context.Context, try func() bool) error {
+	for woken := false; ; woken = true {
+		if try() {
+			if woken {
+				// Pass the wake up on, there may be more to do.
+				w.wake()
+			}
+			return nil
+		}
+		atomic.AddInt32(&w.n, 1)
+		if try() {
+			atomic.AddInt32(&w.n, -1)
+			return nil
+		}
+		select {
+		case <-w.ch:
+			atomic.AddInt32(&w.n, -1)
+		case <-ctx.Done():
+			atomic.AddInt32(&w.n, -1)
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"context"
+	"store"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	for _, mode := range []store.RingMode{store.MPMC, store.SPSC} {
+		r := store.NewRing(3, mode)
+		if r.Cap() != 4 {
+			t.Fatal(fmtfn("cap", r.Cap(), 4))
+		}
+		if v, ok := r.TryPop(); v != nil || ok {
+			t.Fatalf("TryPop on empty: got %v %v, want nil false", v, ok)
+		}
+		for i, v := range []any{1, nil, "foo", 2} {
+			if !r.TryPush(v) {
+				t.Fatalf("TryPush %d failed", i)
+			}
+		}
+		if r.TryPush(3) || r.Len() != 4 {
+			t.Fatalf("TryPush on full ring succeeded, len %d", r.Len())
+		}
+		for _, want := range []any{1, nil, "foo", 2} {
+			if v, ok := r.TryPop(); v != want || !ok {
+				t.Fatalf("TryPop: got %v %v, want %v true", v, ok, want)
+			}
+		}
+		if r.Len() != 0 {
+			t.Fatal(fmtfn("len", r.Len(), 0))
+		}
+	}
+}
+
+func TestRingBlocking(t *testing.T) {
+	r := store.NewRing(2, store.MPMC)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Pop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Pop on empty: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	r.TryPush(0)
+	r.TryPush(1)
+	if err := r.Push(ctx, 2); err != context.DeadlineExceeded {
+		t.Fatalf("Push on full: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	go func() {
+		time.Sleep(time.Millisecond)
+		r.TryPop()
+	}()
+	if err := r.Push(context.Background(), 2); err != nil {
+		t.Fatalf("Push: got %v, want nil", err)
+	}
+	for _, want := range []any{1, 2} {
+		if v, err := r.Pop(context.Background()); v != want || err != nil {
+			t.Fatalf("Pop: got %v %v, want %v nil", v, err, want)
+		}
+	}
+}
+
+func TestRingConcurrent(t *testing.T) {
+	var m, n uint64 = 16, 10000
+	if testing.Short() {
+		n = 1000
+	}
+	for _, tt := range []struct {
+		mode      store.RingMode
+		producers uint64
+	}{
+		{store.MPMC, m},
+		{store.SPSC, 1},
+	} {
+		r := store.NewRing(8, tt.mode)
+		var count uint64
+		var g sync.WaitGroup
+		ctx := context.Background()
+		total := tt.producers * n
+		for i := uint64(0); i < total; i += n {
+			i := i
+			g.Add(2)
+			go func() {
+				for v := i; v < i+n; v++ {
+					if err := r.Push(ctx, v); err != nil {
+						t.Error(err)
+					}
+				}
+				g.Done()
+			}()
+			go func() {
+				var c uint64
+				for j := uint64(0); j < n; j++ {
+					v, err := r.Pop(ctx)
+					if err != nil {
+						t.Error(err)
+					}
+					c += v.(uint64)
+				}
+				atomic.AddUint64(&count, c)
+				g.Done()
+			}()
+		}
+		g.Wait()
+		if want := (total - 1) * total / 2; count != want {
+			t.Errorf("mode %v: sum from 0 to %d was %d, want %v", tt.mode, total-1, count, want)
+		}
+	}
+}
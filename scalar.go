@@ -0,0 +1,312 @@
+package store
+
+import (
+	"bytes"
+	"math"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// scalar is the typed store API shared by the scalar types.
+type scalar[T any] interface {
+	Load() (val T)
+	Store(val T)
+	Swap(new T) (old T)
+	CompareAndSwap(old, new T) (swapped bool)
+}
+
+// scalarAdapter exposes a scalar as an Interface.
+// A scalar always holds a value, so LoadOk reports true
+// and Reset stores the zero value.
+type scalarAdapter[T any] struct {
+	s scalar[T]
+}
+
+// conv converts val to T, nil to the zero value.
+func (a scalarAdapter[T]) conv(val any) (v T) {
+	if val == nil {
+		return v
+	}
+	v, ok := val.(T)
+	if !ok {
+		panic(ErrInconsistentType)
+	}
+	return v
+}
+
+func (a scalarAdapter[T]) Load() (val any)            { return a.s.Load() }
+func (a scalarAdapter[T]) LoadOk() (val any, ok bool) { return a.s.Load(), true }
+func (a scalarAdapter[T]) Store(val any)              { a.s.Store(a.conv(val)) }
+func (a scalarAdapter[T]) Swap(new any) (old any)     { return a.s.Swap(a.conv(new)) }
+func (a scalarAdapter[T]) Reset()                     { a.s.Store(a.conv(nil)) }
+func (a scalarAdapter[T]) CompareAndSwap(old, new any) (swapped bool) {
+	return a.s.CompareAndSwap(a.conv(old), a.conv(new))
+}
+
+// A Bool is an atomic bool. The zero value is false.
+type Bool struct {
+	v uint32
+}
+
+func b32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Bool) Load() (val bool) { return atomic.LoadUint32(&x.v) != 0 }
+
+// Store atomically stores val into x.
+func (x *Bool) Store(val bool) { atomic.StoreUint32(&x.v, b32(val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Bool) Swap(new bool) (old bool) { return atomic.SwapUint32(&x.v, b32(new)) != 0 }
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Bool) CompareAndSwap(old, new bool) (swapped bool) {
+	return atomic.CompareAndSwapUint32(&x.v, b32(old), b32(new))
+}
+
+// Interface returns x as an Interface storing bool values.
+func (x *Bool) Interface() Interface { return scalarAdapter[bool]{x} }
+
+// word64 holds a 64-bit word for the 64-bit atomics, which need it
+// 8-byte aligned on 386 and 32-bit ARM even where the compiler only
+// aligns it to 4, as in a struct embedding a scalar: it is whichever
+// 8 of its 12 bytes are aligned.
+type word64 struct {
+	w [3]uint32
+}
+
+func (w *word64) uint64() *uint64 {
+	if uintptr(unsafe.Pointer(&w.w))%8 == 0 {
+		return (*uint64)(unsafe.Pointer(&w.w[0]))
+	}
+	return (*uint64)(unsafe.Pointer(&w.w[1]))
+}
+
+func (w *word64) int64() *int64 { return (*int64)(unsafe.Pointer(w.uint64())) }
+
+// An Int64 is an atomic int64. The zero value is zero.
+type Int64 struct {
+	v word64
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Int64) Load() (val int64) { return atomic.LoadInt64(x.v.int64()) }
+
+// Store atomically stores val into x.
+func (x *Int64) Store(val int64) { atomic.StoreInt64(x.v.int64(), val) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Int64) Swap(new int64) (old int64) { return atomic.SwapInt64(x.v.int64(), new) }
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Int64) CompareAndSwap(old, new int64) (swapped bool) {
+	return atomic.CompareAndSwapInt64(x.v.int64(), old, new)
+}
+
+// Add atomically adds delta to x and returns the new value.
+func (x *Int64) Add(delta int64) (new int64) { return atomic.AddInt64(x.v.int64(), delta) }
+
+// Sub atomically subtracts delta from x and returns the new value.
+func (x *Int64) Sub(delta int64) (new int64) { return atomic.AddInt64(x.v.int64(), -delta) }
+
+// Interface returns x as an Interface storing int64 values.
+func (x *Int64) Interface() Interface { return scalarAdapter[int64]{x} }
+
+// A Uint64 is an atomic uint64. The zero value is zero.
+type Uint64 struct {
+	v word64
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Uint64) Load() (val uint64) { return atomic.LoadUint64(x.v.uint64()) }
+
+// Store atomically stores val into x.
+func (x *Uint64) Store(val uint64) { atomic.StoreUint64(x.v.uint64(), val) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Uint64) Swap(new uint64) (old uint64) { return atomic.SwapUint64(x.v.uint64(), new) }
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Uint64) CompareAndSwap(old, new uint64) (swapped bool) {
+	return atomic.CompareAndSwapUint64(x.v.uint64(), old, new)
+}
+
+// Add atomically adds delta to x and returns the new value.
+func (x *Uint64) Add(delta uint64) (new uint64) { return atomic.AddUint64(x.v.uint64(), delta) }
+
+// Sub atomically subtracts delta from x and returns the new value.
+func (x *Uint64) Sub(delta uint64) (new uint64) { return atomic.AddUint64(x.v.uint64(), ^(delta - 1)) }
+
+// Interface returns x as an Interface storing uint64 values.
+func (x *Uint64) Interface() Interface { return scalarAdapter[uint64]{x} }
+
+// A Float64 is an atomic float64. The zero value is zero.
+// CompareAndSwap compares bit patterns, so NaN matches
+// an identical NaN and 0 does not match -0.
+type Float64 struct {
+	v word64
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Float64) Load() (val float64) { return math.Float64frombits(atomic.LoadUint64(x.v.uint64())) }
+
+// Store atomically stores val into x.
+func (x *Float64) Store(val float64) { atomic.StoreUint64(x.v.uint64(), math.Float64bits(val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Float64) Swap(new float64) (old float64) {
+	return math.Float64frombits(atomic.SwapUint64(x.v.uint64(), math.Float64bits(new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Float64) CompareAndSwap(old, new float64) (swapped bool) {
+	return atomic.CompareAndSwapUint64(x.v.uint64(), math.Float64bits(old), math.Float64bits(new))
+}
+
+// Add atomically adds delta to x and returns the new value.
+func (x *Float64) Add(delta float64) (new float64) {
+	for {
+		old := atomic.LoadUint64(x.v.uint64())
+		new = math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(x.v.uint64(), old, math.Float64bits(new)) {
+			return new
+		}
+	}
+}
+
+// Sub atomically subtracts delta from x and returns the new value.
+func (x *Float64) Sub(delta float64) (new float64) { return x.Add(-delta) }
+
+// Interface returns x as an Interface storing float64 values.
+func (x *Float64) Interface() Interface { return scalarAdapter[float64]{x} }
+
+// A Duration is an atomic time.Duration. The zero value is zero.
+type Duration struct {
+	v word64
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Duration) Load() (val time.Duration) { return time.Duration(atomic.LoadInt64(x.v.int64())) }
+
+// Store atomically stores val into x.
+func (x *Duration) Store(val time.Duration) { atomic.StoreInt64(x.v.int64(), int64(val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Duration) Swap(new time.Duration) (old time.Duration) {
+	return time.Duration(atomic.SwapInt64(x.v.int64(), int64(new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Duration) CompareAndSwap(old, new time.Duration) (swapped bool) {
+	return atomic.CompareAndSwapInt64(x.v.int64(), int64(old), int64(new))
+}
+
+// Add atomically adds delta to x and returns the new value.
+func (x *Duration) Add(delta time.Duration) (new time.Duration) {
+	return time.Duration(atomic.AddInt64(x.v.int64(), int64(delta)))
+}
+
+// Sub atomically subtracts delta from x and returns the new value.
+func (x *Duration) Sub(delta time.Duration) (new time.Duration) {
+	return time.Duration(atomic.AddInt64(x.v.int64(), -int64(delta)))
+}
+
+// Interface returns x as an Interface storing time.Duration values.
+func (x *Duration) Interface() Interface { return scalarAdapter[time.Duration]{x} }
+
+// A Time is an atomic time.Time. The zero value is the zero time.
+// A time.Time does not fit in a machine word, so Store allocates,
+// but Load needs no type assertion. CompareAndSwap compares
+// instants with time.Time.Equal.
+type Time struct {
+	p unsafe.Pointer // *time.Time
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Time) Load() (val time.Time) { return ptr2val[time.Time](atomic.LoadPointer(&x.p)) }
+
+// Store atomically stores val into x.
+func (x *Time) Store(val time.Time) { atomic.StorePointer(&x.p, unsafe.Pointer(&val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Time) Swap(new time.Time) (old time.Time) {
+	return ptr2val[time.Time](atomic.SwapPointer(&x.p, unsafe.Pointer(&new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Time) CompareAndSwap(old, new time.Time) (swapped bool) {
+	p := atomic.LoadPointer(&x.p)
+	if !ptr2val[time.Time](p).Equal(old) {
+		return false
+	}
+	return atomic.CompareAndSwapPointer(&x.p, p, unsafe.Pointer(&new))
+}
+
+// Interface returns x as an Interface storing time.Time values.
+func (x *Time) Interface() Interface { return scalarAdapter[time.Time]{x} }
+
+// A String is an atomic string. The zero value is "".
+// Store allocates, but Load needs no type assertion.
+type String struct {
+	p unsafe.Pointer // *string
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *String) Load() (val string) { return ptr2val[string](atomic.LoadPointer(&x.p)) }
+
+// Store atomically stores val into x.
+func (x *String) Store(val string) { atomic.StorePointer(&x.p, unsafe.Pointer(&val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *String) Swap(new string) (old string) {
+	return ptr2val[string](atomic.SwapPointer(&x.p, unsafe.Pointer(&new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *String) CompareAndSwap(old, new string) (swapped bool) {
+	p := atomic.LoadPointer(&x.p)
+	if ptr2val[string](p) != old {
+		return false
+	}
+	return atomic.CompareAndSwapPointer(&x.p, p, unsafe.Pointer(&new))
+}
+
+// Interface returns x as an Interface storing string values.
+func (x *String) Interface() Interface { return scalarAdapter[string]{x} }
+
+// A Bytes is an atomic []byte. The zero value is nil.
+// Store keeps the slice it is given and Load returns it,
+// neither must be modified afterwards. CompareAndSwap
+// compares contents with bytes.Equal.
+type Bytes struct {
+	p unsafe.Pointer // *[]byte
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Bytes) Load() (val []byte) { return ptr2val[[]byte](atomic.LoadPointer(&x.p)) }
+
+// Store atomically stores val into x.
+func (x *Bytes) Store(val []byte) { atomic.StorePointer(&x.p, unsafe.Pointer(&val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Bytes) Swap(new []byte) (old []byte) {
+	return ptr2val[[]byte](atomic.SwapPointer(&x.p, unsafe.Pointer(&new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Bytes) CompareAndSwap(old, new []byte) (swapped bool) {
+	p := atomic.LoadPointer(&x.p)
+	if !bytes.Equal(ptr2val[[]byte](p), old) {
+		return false
+	}
+	return atomic.CompareAndSwapPointer(&x.p, p, unsafe.Pointer(&new))
+}
+
+// Interface returns x as an Interface storing []byte values.
+func (x *Bytes) Interface() Interface { return scalarAdapter[[]byte]{x} }
@@ -0,0 +1,206 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"store"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBool(t *testing.T) {
+	var x store.Bool
+	if x.Load() {
+		t.Fatal("initial Bool is not false")
+	}
+	x.Store(true)
+	if old := x.Swap(false); !old {
+		t.Fatal(fmtfn("swap", old, true))
+	}
+	if x.CompareAndSwap(true, false) || !x.CompareAndSwap(false, true) || !x.Load() {
+		t.Fatal("cas wrong result")
+	}
+}
+
+func TestInt64(t *testing.T) {
+	var x store.Int64
+	x.Store(1)
+	if n := x.Add(2); n != 3 {
+		t.Fatal(fmtfn("add", n, 3))
+	}
+	if n := x.Sub(5); n != -2 {
+		t.Fatal(fmtfn("sub", n, -2))
+	}
+	if old := x.Swap(7); old != -2 {
+		t.Fatal(fmtfn("swap", old, -2))
+	}
+	if !x.CompareAndSwap(7, 8) || x.Load() != 8 {
+		t.Fatal("cas wrong result")
+	}
+}
+
+func TestUint64(t *testing.T) {
+	var x store.Uint64
+	if n := x.Add(5); n != 5 {
+		t.Fatal(fmtfn("add", n, 5))
+	}
+	if n := x.Sub(2); n != 3 {
+		t.Fatal(fmtfn("sub", n, 3))
+	}
+	if !x.CompareAndSwap(3, math.MaxUint64) || x.Load() != math.MaxUint64 {
+		t.Fatal("cas wrong result")
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	var x store.Float64
+	if n := x.Add(1.5); n != 1.5 {
+		t.Fatal(fmtfn("add", n, 1.5))
+	}
+	if n := x.Sub(0.5); n != 1 {
+		t.Fatal(fmtfn("sub", n, 1))
+	}
+	nan := math.NaN()
+	x.Store(nan)
+	if !x.CompareAndSwap(nan, 2) || x.Load() != 2 {
+		t.Fatal("cas of identical NaN should succeed")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	var x store.Duration
+	x.Add(time.Second)
+	if d := x.Sub(time.Millisecond); d != 999*time.Millisecond {
+		t.Fatal(fmtfn("sub", d, 999*time.Millisecond))
+	}
+	if !x.CompareAndSwap(999*time.Millisecond, 0) || x.Load() != 0 {
+		t.Fatal("cas wrong result")
+	}
+}
+
+func TestScalarUnaligned(t *testing.T) {
+	// On 386 and ARM, the compiler aligns the scalars to 4 bytes only.
+	var x struct {
+		_ uint32
+		i store.Int64
+		_ uint32
+		u store.Uint64
+		_ uint32
+		f store.Float64
+		_ uint32
+		d store.Duration
+	}
+	if x.i.Add(2) != 2 || x.u.Add(2) != 2 || x.f.Add(2) != 2 || x.d.Add(2) != 2 {
+		t.Fatal("Add wrong result")
+	}
+	if !x.i.CompareAndSwap(2, 3) || !x.u.CompareAndSwap(2, 3) || !x.f.CompareAndSwap(2, 3) || !x.d.CompareAndSwap(2, 3) {
+		t.Fatal("cas wrong result")
+	}
+}
+
+func TestTime(t *testing.T) {
+	var x store.Time
+	if !x.Load().IsZero() {
+		t.Fatal("initial Time is not zero")
+	}
+	now := time.Now()
+	if !x.CompareAndSwap(time.Time{}, now) {
+		t.Fatal("cas from zero time should succeed")
+	}
+	// Equal instants match whatever their location.
+	if !x.CompareAndSwap(now.UTC(), now.Add(time.Hour)) {
+		t.Fatal("cas of equal instant should succeed")
+	}
+	if old := x.Swap(now); !old.Equal(now.Add(time.Hour)) {
+		t.Fatal(fmtfn("swap", old, now.Add(time.Hour)))
+	}
+}
+
+func TestString(t *testing.T) {
+	var x store.String
+	x.Store("foo")
+	if old := x.Swap("bar"); old != "foo" {
+		t.Fatal(fmtfn("swap", old, "foo"))
+	}
+	if x.CompareAndSwap("foo", "baz") || !x.CompareAndSwap("bar", "baz") || x.Load() != "baz" {
+		t.Fatal("cas wrong result")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	var x store.Bytes
+	if !x.CompareAndSwap(nil, []byte("foo")) {
+		t.Fatal("cas from nil should succeed")
+	}
+	if !x.CompareAndSwap([]byte("foo"), []byte("bar")) || !bytes.Equal(x.Load(), []byte("bar")) {
+		t.Fatal("cas of equal contents should succeed")
+	}
+}
+
+func TestScalarInterface(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		v    store.Interface
+		a, b any
+	}{
+		{"Bool", new(store.Bool).Interface(), false, true},
+		{"Int64", new(store.Int64).Interface(), int64(0), int64(1)},
+		{"Uint64", new(store.Uint64).Interface(), uint64(0), uint64(1)},
+		{"Float64", new(store.Float64).Interface(), float64(0), float64(1)},
+		{"Duration", new(store.Duration).Interface(), time.Duration(0), time.Second},
+		{"String", new(store.String).Interface(), "", "foo"},
+	} {
+		v := tt.v
+		if x, ok := v.LoadOk(); x != tt.a || !ok {
+			t.Fatalf("%s LoadOk: got %v %v, want %v true", tt.name, x, ok, tt.a)
+		}
+		v.Store(tt.b)
+		if x := v.Swap(tt.a); x != tt.b {
+			t.Fatal(fmtfn(tt.name+" swap", x, tt.b))
+		}
+		if !v.CompareAndSwap(nil, tt.b) || v.Load() != tt.b {
+			t.Fatalf("%s cas from zero should succeed", tt.name)
+		}
+		v.Reset()
+		if x := v.Load(); x != tt.a {
+			t.Fatal(fmtfn(tt.name+" load after Reset", x, tt.a))
+		}
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, store.ErrInconsistentType) {
+					t.Errorf("%s inconsistent store panic: got '%v', want '%v'", tt.name, err, store.ErrInconsistentType)
+				}
+			}()
+			v.Store(struct{}{})
+		}()
+	}
+}
+
+func TestInt64Concurrent(t *testing.T) {
+	var x store.Int64
+	var f store.Float64
+	var w sync.WaitGroup
+	m, n := 100, 1000
+	if testing.Short() {
+		m = 10
+		n = 100
+	}
+	for i := 0; i < m; i++ {
+		w.Add(1)
+		go func() {
+			for j := 0; j < n; j++ {
+				x.Add(2)
+				x.Sub(1)
+				f.Add(1)
+			}
+			w.Done()
+		}()
+	}
+	w.Wait()
+	if x.Load() != int64(m*n) || f.Load() != float64(m*n) {
+		t.Errorf("did not get to %v, stopped at %v and %v", m*n, x.Load(), f.Load())
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A SeqValue holds a plain-old-data value of type T inline and guards
+// it with a sequence lock: Store never allocates, Load copies the value
+// out and retries if a Store tore it meanwhile.
+//
+// T must not contain pointers, strings, slices, maps, channels,
+// functions or interfaces; Store panics otherwise. Stores are
+// serialized, Loads only ever wait for a Store in progress.
+//
+// The zero SeqValue holds the zero T and is ready for use.
+// A SeqValue must not be copied after first use.
+type SeqValue[T any] struct {
+	seq     uintptr // odd while a Store is in progress
+	data    T       // word aligned, following seq
+	_       [8]byte // lets the last word of data be copied whole
+	checked bool    // T was found free of pointers, guarded by seq
+}
+
+const wordSize = unsafe.Sizeof(uintptr(0))
+
+// Load returns the value set by the most recent Store.
+func (s *SeqValue[T]) Load() (val T) {
+	for spins := 0; ; spins++ {
+		seq := atomic.LoadUintptr(&s.seq)
+		if seq&1 == 0 {
+			seqCopy(unsafe.Pointer(&val), unsafe.Pointer(&s.data), unsafe.Sizeof(val), false)
+			if atomic.LoadUintptr(&s.seq) == seq {
+				return val
+			}
+		}
+		if spins >= 16 {
+			runtime.Gosched()
+		}
+	}
+}
+
+// Store sets the value to val.
+func (s *SeqValue[T]) Store(val T) {
+	seq := s.lock()
+	defer atomic.StoreUintptr(&s.seq, seq+2)
+	s.store(&val)
+}
+
+// Update calls fn with a pointer to a copy of the current value and
+// stores the modified copy. Stores wait for fn, Loads do not.
+func (s *SeqValue[T]) Update(fn func(cur *T)) {
+	seq := s.lock()
+	defer atomic.StoreUintptr(&s.seq, seq+2)
+	// Only writers, which hold the lock, change data,
+	// so this plain copy cannot tear.
+	val := s.data
+	fn(&val)
+	s.store(&val)
+}
+
+// store copies *val into data, the caller holds the lock.
+func (s *SeqValue[T]) store(val *T) {
+	if !s.checked {
+		if err := checkPOD(reflect.TypeOf(val).Elem()); err != nil {
+			panic(err)
+		}
+		s.checked = true
+	}
+	seqCopy(unsafe.Pointer(&s.data), unsafe.Pointer(val), unsafe.Sizeof(*val), true)
+}
+
+// lock waits for the sequence to be even and makes it odd.
+func (s *SeqValue[T]) lock() (seq uintptr) {
+	for spins := 0; ; spins++ {
+		seq = atomic.LoadUintptr(&s.seq)
+		if seq&1 == 0 && atomic.CompareAndSwapUintptr(&s.seq, seq, seq+1) {
+			return seq
+		}
+		if spins >= 16 {
+			runtime.Gosched()
+		}
+	}
+}
+
+// seqCopy copies n bytes from src to dst a word at a time with atomic
+// loads, or stores if into is set, so that racing Loads and Stores are
+// well defined. The seq side, src for a load and dst for a store, must
+// be readable or writable up to the next word boundary.
+func seqCopy(dst, src unsafe.Pointer, n uintptr, into bool) {
+	i := uintptr(0)
+	for ; i+wordSize <= n; i += wordSize {
+		d, s := (*uintptr)(unsafe.Add(dst, i)), (*uintptr)(unsafe.Add(src, i))
+		if into {
+			atomic.StoreUintptr(d, *s)
+		} else {
+			*d = atomic.LoadUintptr(s)
+		}
+	}
+	if i == n {
+		return
+	}
+	// Copy the tail through a whole word.
+	var w uintptr
+	tail := (*[8]byte)(unsafe.Pointer(&w))[: n-i : n-i]
+	if into {
+		copy(tail, unsafe.Slice((*byte)(unsafe.Add(src, i)), n-i))
+		atomic.StoreUintptr((*uintptr)(unsafe.Add(dst, i)), w)
+	} else {
+		w = atomic.LoadUintptr((*uintptr)(unsafe.Add(src, i)))
+		copy(unsafe.Slice((*byte)(unsafe.Add(dst, i)), n-i), tail)
+	}
+}
+
+// podTypes caches the result of checkPOD by type.
+var podTypes sync.Map // reflect.Type to error
+
+// checkPOD returns an error if t holds pointers, which seqCopy would
+// hide from the garbage collector.
+func checkPOD(t reflect.Type) error {
+	if err, ok := podTypes.Load(t); ok {
+		err, _ := err.(error)
+		return err
+	}
+	var err error
+	if hasPointers(t) {
+		err = &podError{t}
+	}
+	podTypes.Store(t, err)
+	return err
+}
+
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Ptr, reflect.UnsafePointer, reflect.String, reflect.Slice,
+		reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+type podError struct{ t reflect.Type }
+
+func (e *podError) Error() string {
+	return "store: SeqValue of " + e.t.String() + ", which holds pointers"
+}
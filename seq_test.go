@@ -0,0 +1,103 @@
+package store_test
+
+import (
+	"runtime"
+	"store"
+	"sync"
+	"testing"
+)
+
+type stats struct {
+	Count, Sum, Min, Max int64
+	Mean, Var            float64
+	Hist                 [2]uint64
+}
+
+// odd has a size that is not a multiple of the word size.
+type odd struct {
+	A [3]byte
+	B uint16
+	C [5]byte
+}
+
+func TestSeqValue(t *testing.T) {
+	var s store.SeqValue[stats]
+	if v := s.Load(); v != (stats{}) {
+		t.Fatal(fmtfn("initial SeqValue", v, stats{}))
+	}
+	want := stats{Count: 1, Sum: 2, Min: -3, Max: 4, Mean: 0.5, Var: 1.5, Hist: [2]uint64{7, 8}}
+	s.Store(want)
+	if v := s.Load(); v != want {
+		t.Fatal(fmtfn("load", v, want))
+	}
+	s.Update(func(cur *stats) { cur.Count++ })
+	if v := s.Load(); v.Count != 2 || v.Hist != want.Hist {
+		t.Fatal(fmtfn("update", v, want))
+	}
+
+	var o store.SeqValue[odd]
+	ow := odd{A: [3]byte{1, 2, 3}, B: 0xffff, C: [5]byte{4, 5, 6, 7, 8}}
+	o.Store(ow)
+	if v := o.Load(); v != ow {
+		t.Fatal(fmtfn("odd load", v, ow))
+	}
+	var b store.SeqValue[[3]byte]
+	b.Store([3]byte{9, 9, 9})
+	if v := b.Load(); v != [3]byte{9, 9, 9} {
+		t.Fatal(fmtfn("bytes load", v, [3]byte{9, 9, 9}))
+	}
+}
+
+func TestSeqValuePointers(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("SeqValue of a type with pointers should panic")
+		}
+	}()
+	var s store.SeqValue[struct {
+		N    int
+		Name string
+	}]
+	s.Store(s.Load())
+}
+
+func TestSeqValueConcurrent(t *testing.T) {
+	var s store.SeqValue[[8]int64]
+	p := runtime.GOMAXPROCS(0)
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	var w sync.WaitGroup
+	for i := 0; i < p; i++ {
+		w.Add(2)
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				s.Update(func(cur *[8]int64) {
+					for k := range cur {
+						cur[k]++
+					}
+				})
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for j := 0; j < n; j++ {
+				// Every word is written together, a torn read would
+				// see them differ.
+				v := s.Load()
+				for k := range v {
+					if v[k] != v[0] {
+						t.Errorf("torn read: %v", v)
+						return
+					}
+				}
+			}
+		}()
+	}
+	w.Wait()
+	if v := s.Load(); v[7] != int64(p*n) {
+		t.Fatal(fmtfn("final", v[7], p*n))
+	}
+}
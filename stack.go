@@ -0,0 +1,72 @@
+package store
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Stack is a lock-free LIFO stack, a Treiber stack.
+// Values of mixed types and nil values may be pushed.
+//
+// Every Push allocates a new node, and the garbage collector does not
+// reuse a node while a Pop still holds it, so the pointer
+// compare-and-swap is not subject to the ABA problem.
+//
+// The zero Stack is empty and ready for use.
+type Stack struct {
+	n   int64
+	top unsafe.Pointer // *stackNode
+}
+
+type stackNode struct {
+	val  any
+	next *stackNode
+}
+
+// Push adds val to the top of the stack.
+func (s *Stack) Push(val any) {
+	n := &stackNode{val: val}
+	for {
+		top := atomic.LoadPointer(&s.top)
+		n.next = (*stackNode)(top)
+		if atomic.CompareAndSwapPointer(&s.top, top, unsafe.Pointer(n)) {
+			atomic.AddInt64(&s.n, 1)
+			return
+		}
+	}
+}
+
+// Pop removes and returns the value at the top of the stack.
+// The ok result reports whether the stack was not empty.
+func (s *Stack) Pop() (val any, ok bool) {
+	for {
+		top := atomic.LoadPointer(&s.top)
+		if top == nil {
+			return nil, false
+		}
+		n := (*stackNode)(top)
+		if atomic.CompareAndSwapPointer(&s.top, top, unsafe.Pointer(n.next)) {
+			atomic.AddInt64(&s.n, -1)
+			return n.val, true
+		}
+	}
+}
+
+// Peek returns the value at the top of the stack without removing it.
+// The ok result reports whether the stack was not empty.
+func (s *Stack) Peek() (val any, ok bool) {
+	top := atomic.LoadPointer(&s.top)
+	if top == nil {
+		return nil, false
+	}
+	return (*stackNode)(top).val, true
+}
+
+// Len returns the number of values in the stack.
+// Under concurrent use it is only an estimate.
+func (s *Stack) Len() int {
+	if n := atomic.LoadInt64(&s.n); n > 0 {
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package store_test
+
+import (
+	"store"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStack(t *testing.T) {
+	var s store.Stack
+	if v, ok := s.Pop(); v != nil || ok {
+		t.Fatalf("Pop on empty: got %v %v, want nil false", v, ok)
+	}
+	s.Push(1)
+	s.Push(nil)
+	s.Push("foo")
+	if v, ok := s.Peek(); v != "foo" || !ok || s.Len() != 3 {
+		t.Fatalf("Peek: got %v %v len %d, want foo true len 3", v, ok, s.Len())
+	}
+	for _, want := range []any{"foo", nil, 1} {
+		if v, ok := s.Pop(); v != want || !ok {
+			t.Fatalf("Pop: got %v %v, want %v true", v, ok, want)
+		}
+	}
+	if _, ok := s.Peek(); ok || s.Len() != 0 {
+		t.Fatal("stack not empty after popping everything")
+	}
+}
+
+func TestStackConcurrent(t *testing.T) {
+	var s store.Stack
+	var count uint64
+	var g sync.WaitGroup
+	var m, n uint64 = 100, 1000
+	if testing.Short() {
+		m = 10
+		n = 100
+	}
+	for i := uint64(0); i < m*n; i += n {
+		i := i
+		g.Add(1)
+		go func() {
+			var c uint64
+			for v := i; v < i+n; v++ {
+				s.Push(v)
+				if old, ok := s.Pop(); ok {
+					c += old.(uint64)
+				}
+			}
+			atomic.AddUint64(&count, c)
+			g.Done()
+		}()
+	}
+	g.Wait()
+	for {
+		old, ok := s.Pop()
+		if !ok {
+			break
+		}
+		count += old.(uint64)
+	}
+	if want := (m*n - 1) * (m * n) / 2; count != want {
+		t.Errorf("sum from 0 to %d was %d, want %v", m*n-1, count, want)
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import "unsafe"
+
+// A Tx is a transaction run by Atomically. Its Loads and Stores are
+// buffered and applied together when fn returns, as one CompareAndSwapN.
+// A Tx must only be used by the goroutine running fn, and not after
+// fn returns.
+type Tx struct {
+	reads  map[*Entry]unsafe.Pointer // value pointer first seen
+	writes map[*Entry]any
+}
+
+// txAbort is panicked by a Tx to unwind fn,
+// retry tells whether to wait for a change first.
+type txAbort struct{ retry bool }
+
+// Atomically runs fn as a transaction: the Entries fn loads form a
+// consistent snapshot, and its stores are applied together, only if
+// none of those Entries changed meanwhile. Otherwise fn runs again.
+//
+// If fn returns an error, nothing is stored and Atomically returns
+// the error. fn may run several times and should have no side effects
+// besides the Tx. Plain Load of an Entry never sees half of a commit.
+func Atomically(fn func(tx *Tx) error) error {
+	for {
+		tx := &Tx{reads: map[*Entry]unsafe.Pointer{}, writes: map[*Entry]any{}}
+		abort, err := tx.run(fn)
+		switch {
+		case abort == nil && err != nil:
+			return err
+		case abort == nil:
+			if tx.commit() {
+				return nil
+			}
+		case abort.retry:
+			tx.wait()
+		}
+	}
+}
+
+func (tx *Tx) run(fn func(tx *Tx) error) (abort *txAbort, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			a, ok := r.(txAbort)
+			if !ok {
+				panic(r)
+			}
+			abort = &a
+		}
+	}()
+	return nil, fn(tx)
+}
+
+// Load returns the value of e as seen by the transaction.
+func (tx *Tx) Load(e *Entry) (val any) {
+	if val, ok := tx.writes[e]; ok {
+		return val
+	}
+	return ptr2any(tx.read(e))
+}
+
+// Store sets the value of e when the transaction commits.
+func (tx *Tx) Store(e *Entry, val any) {
+	tx.read(e)
+	tx.writes[e] = val
+}
+
+// Retry abandons the transaction and runs it again once an Entry it
+// loaded has changed, by a transaction or not. It does not return.
+func (tx *Tx) Retry() {
+	panic(txAbort{retry: true})
+}
+
+// read returns the value pointer of e the transaction works with.
+// Reading a new Entry checks that the earlier ones did not change,
+// so that fn never sees an inconsistent snapshot.
+func (tx *Tx) read(e *Entry) unsafe.Pointer {
+	if p, ok := tx.reads[e]; ok {
+		return p
+	}
+	p := e.load()
+	if !tx.valid() {
+		panic(txAbort{})
+	}
+	tx.reads[e] = p
+	return p
+}
+
+func (tx *Tx) valid() bool {
+	for e, p := range tx.reads {
+		if e.load() != p {
+			return false
+		}
+	}
+	return true
+}
+
+func (tx *Tx) commit() bool {
+	if len(tx.writes) == 0 {
+		// Every read was validated by the last one.
+		return true
+	}
+	ops := make([]mcasOp, 0, len(tx.reads))
+	for e, p := range tx.reads {
+		new := p
+		if val, ok := tx.writes[e]; ok {
+			new = unsafe.Pointer(&val)
+		}
+		ops = append(ops, mcasOp{e: e, oldp: p, byPtr: true, new: new})
+	}
+	d := newMCAS(ops)
+	if !d.help() {
+		return false
+	}
+	d.wake()
+	return true
+}
+
+// wait blocks until an Entry tx read has changed.
+func (tx *Tx) wait() {
+	ch := make(chan struct{}, 1)
+	for e := range tx.reads {
+		w := waitersAt(&e.w)
+		w.add(ch)
+		defer w.remove(ch)
+	}
+	// A write after this check signals ch.
+	for tx.valid() {
+		<-ch
+	}
+}
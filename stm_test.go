@@ -0,0 +1,135 @@
+package store_test
+
+import (
+	"errors"
+	"runtime"
+	"store"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAtomically(t *testing.T) {
+	var a, b store.Entry
+	a.Store(10)
+	err := store.Atomically(func(tx *store.Tx) error {
+		x, _ := tx.Load(&a).(int)
+		tx.Store(&a, x-3)
+		tx.Store(&b, x)
+		if v := tx.Load(&a); v != 7 {
+			t.Error(fmtfn("load own store", v, 7))
+		}
+		return nil
+	})
+	if err != nil || a.Load() != 7 || b.Load() != 10 {
+		t.Fatalf("commit: got %v %v %v, want nil 7 10", err, a.Load(), b.Load())
+	}
+
+	errStop := errors.New("stop")
+	err = store.Atomically(func(tx *store.Tx) error {
+		tx.Store(&a, 0)
+		return errStop
+	})
+	if err != errStop || a.Load() != 7 {
+		t.Fatalf("failed transaction: got %v %v, want %v 7", err, a.Load(), errStop)
+	}
+}
+
+func TestAtomicallyPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatal(fmtfn("panic", r, "boom"))
+		}
+	}()
+	store.Atomically(func(tx *store.Tx) error { panic("boom") })
+}
+
+func TestAtomicallyRetry(t *testing.T) {
+	for _, plain := range []bool{false, true} {
+		var ready, out store.Entry
+		done := make(chan error)
+		go func() {
+			done <- store.Atomically(func(tx *store.Tx) error {
+				if tx.Load(&ready) == nil {
+					tx.Retry()
+				}
+				tx.Store(&out, tx.Load(&ready))
+				return nil
+			})
+		}()
+		time.Sleep(10 * time.Millisecond)
+		if plain {
+			ready.Store(1)
+		} else {
+			store.Atomically(func(tx *store.Tx) error {
+				tx.Store(&ready, 1)
+				return nil
+			})
+		}
+		select {
+		case err := <-done:
+			if err != nil || out.Load() != 1 {
+				t.Fatalf("plain %v: got %v %v, want nil 1", plain, err, out.Load())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("plain %v: Retry was not woken", plain)
+		}
+	}
+}
+
+// TestAtomicallyConcurrent moves units between accounts while other
+// transactions check that they always see the same total.
+func TestAtomicallyConcurrent(t *testing.T) {
+	const k = 8
+	var accounts [k]store.Entry
+	for i := range accounts {
+		accounts[i].Store(100)
+	}
+	p := runtime.GOMAXPROCS(0)
+	n := 5000
+	if testing.Short() {
+		n = 500
+	}
+	var w sync.WaitGroup
+	for g := 0; g < p; g++ {
+		g := g
+		w.Add(2)
+		go func() {
+			defer w.Done()
+			for i := 0; i < n; i++ {
+				from, to := &accounts[(g*7+i)%k], &accounts[(g+i*3)%k]
+				if from == to {
+					continue
+				}
+				store.Atomically(func(tx *store.Tx) error {
+					tx.Store(from, tx.Load(from).(int)-1)
+					tx.Store(to, tx.Load(to).(int)+1)
+					return nil
+				})
+			}
+		}()
+		go func() {
+			defer w.Done()
+			for i := 0; i < n/10; i++ {
+				store.Atomically(func(tx *store.Tx) error {
+					total := 0
+					for j := range accounts {
+						total += tx.Load(&accounts[j]).(int)
+					}
+					if total != 100*k {
+						t.Errorf("transaction saw a total of %v, want %v", total, 100*k)
+					}
+					return nil
+				})
+			}
+		}()
+	}
+	w.Wait()
+	total := 0
+	for i := range accounts {
+		total += accounts[i].Load().(int)
+	}
+	if total != 100*k {
+		t.Errorf("accounts sum to %v, want %v", total, 100*k)
+	}
+}
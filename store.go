@@ -1,7 +1,29 @@
 package store
 
-// any is an alias for interface{} and is equivalent to interface{} in all ways.
-type any = interface{}
+import "errors"
+
+var (
+	// ErrInconsistentType is returned by TryStore, TrySwap and
+	// TryCompareAndSwap, and panicked by their counterparts, when the
+	// value has a different concrete type from the one already stored.
+	ErrInconsistentType = errors.New("store: inconsistently typed value")
+
+	// ErrUncomparable is returned by TryCompareAndSwap, and panicked by
+	// CompareAndSwap, when the values compared are of an uncomparable
+	// type such as a slice or a map.
+	ErrUncomparable = errors.New("store: comparing uncomparable value")
+)
+
+// equal reports whether x == y, returning ErrUncomparable
+// instead of panicking for uncomparable types.
+func equal(x, y any) (eq bool, err error) {
+	defer func() {
+		if recover() != nil {
+			eq, err = false, ErrUncomparable
+		}
+	}()
+	return x == y, nil
+}
 
 // Interface store interface
 type Interface interface {
@@ -9,6 +31,10 @@ type Interface interface {
 	// It returns nil if there has been no call to Store for this Any.
 	Load() (val any)
 
+	// LoadOk is like Load but also reports whether a value, possibly
+	// nil, has been stored since the Any was created or Reset.
+	LoadOk() (val any, ok bool)
+
 	// Store sets the Any of the Any to x.
 	// All calls to Store for a given Any must use Anys of the same concrete type.
 	// Store of an inconsistent type panics, as does Store(nil).
@@ -27,4 +53,8 @@ type Interface interface {
 	// concrete type. CompareAndSwap of an inconsistent type panics, as does
 	// CompareAndSwap(old, nil).
 	CompareAndSwap(old, new any) (swapped bool)
+
+	// Reset returns the Any to the state where nothing has been stored,
+	// after which it accepts a value of any type.
+	Reset()
 }
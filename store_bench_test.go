@@ -1,27 +1,38 @@
 package store_test
 
 import (
+	"context"
 	"fmt"
 	"store"
 	"sync/atomic"
 	"testing"
 )
 
-func benchFunc(f func(name string, e iface)) {
+// benchIface is the part of iface that atomic.Value implements.
+type benchIface interface {
+	Load() (val any)
+	Store(val any)
+	Swap(new any) (old any)
+	CompareAndSwap(old, new any) (swapped bool)
+}
+
+func benchFunc(f func(name string, e benchIface)) {
 	for _, v := range []struct {
-		iface
+		benchIface
 		name string
 	}{
 		{&atomic.Value{}, "atomic"},
 		{&store.Value{}, "Entry"},
 		{&store.Entry{}, "store"},
+		{&store.TypedValue[any]{}, "TypedValue"},
+		{&store.TypedEntry[any]{}, "TypedEntry"},
 	} {
-		f(v.name, v.iface)
+		f(v.name, v.benchIface)
 	}
 }
 
 func BenchmarkRead(b *testing.B) {
-	benchFunc(func(name string, v iface) {
+	benchFunc(func(name string, v benchIface) {
 		v.Store(0)
 		b.Run(fmt.Sprintf("%s", name), func(b *testing.B) {
 			b.RunParallel(func(pb *testing.PB) {
@@ -38,7 +49,7 @@ func BenchmarkRead(b *testing.B) {
 }
 
 func BenchmarkValueStore(b *testing.B) {
-	benchFunc(func(name string, v iface) {
+	benchFunc(func(name string, v benchIface) {
 		v.Store(0)
 		b.Run(fmt.Sprintf("%s", name), func(b *testing.B) {
 			b.RunParallel(func(pb *testing.PB) {
@@ -53,7 +64,7 @@ func BenchmarkValueStore(b *testing.B) {
 }
 
 func BenchmarkValueStoreLoad(b *testing.B) {
-	benchFunc(func(name string, v iface) {
+	benchFunc(func(name string, v benchIface) {
 		v.Store(0)
 		b.Run(fmt.Sprintf("%s", name), func(b *testing.B) {
 			b.RunParallel(func(pb *testing.PB) {
@@ -71,7 +82,7 @@ func BenchmarkValueStoreLoad(b *testing.B) {
 }
 
 func BenchmarkValueSwap(b *testing.B) {
-	benchFunc(func(name string, v iface) {
+	benchFunc(func(name string, v benchIface) {
 		var i int64
 		b.Run(fmt.Sprintf("%s", name), func(b *testing.B) {
 			b.RunParallel(func(pb *testing.PB) {
@@ -84,7 +95,7 @@ func BenchmarkValueSwap(b *testing.B) {
 }
 
 func BenchmarkValueCAS(b *testing.B) {
-	benchFunc(func(name string, v iface) {
+	benchFunc(func(name string, v benchIface) {
 		v.Store(0)
 		b.Run(fmt.Sprintf("%s", name), func(b *testing.B) {
 			b.RunParallel(func(pb *testing.PB) {
@@ -97,3 +108,105 @@ func BenchmarkValueCAS(b *testing.B) {
 		})
 	})
 }
+
+func BenchmarkRing(b *testing.B) {
+	ctx := context.Background()
+	b.Run("chan", func(b *testing.B) {
+		ch := make(chan any, 1024)
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < b.N; i++ {
+				<-ch
+			}
+			close(done)
+		}()
+		for i := 0; i < b.N; i++ {
+			ch <- i
+		}
+		<-done
+	})
+	for _, mode := range []struct {
+		name string
+		mode store.RingMode
+	}{
+		{"MPMC", store.MPMC},
+		{"SPSC", store.SPSC},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			r := store.NewRing(1024, mode.mode)
+			done := make(chan struct{})
+			go func() {
+				for i := 0; i < b.N; i++ {
+					r.Pop(ctx)
+				}
+				close(done)
+			}()
+			for i := 0; i < b.N; i++ {
+				r.Push(ctx, i)
+			}
+			<-done
+		})
+	}
+}
+
+func BenchmarkRingParallel(b *testing.B) {
+	b.Run("chan", func(b *testing.B) {
+		ch := make(chan any, 1024)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				select {
+				case ch <- 1:
+				default:
+					<-ch
+				}
+			}
+		})
+	})
+	b.Run("MPMC", func(b *testing.B) {
+		r := store.NewRing(1024, store.MPMC)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if !r.TryPush(1) {
+					r.TryPop()
+				}
+			}
+		})
+	})
+}
+
+// benchStats is a 64-byte plain-old-data struct.
+type benchStats struct {
+	A, B, C, D, E, F, G, H int64
+}
+
+func BenchmarkSeqValue(b *testing.B) {
+	b.Run("SeqValue", func(b *testing.B) {
+		var s store.SeqValue[benchStats]
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			var i int64
+			for pb.Next() {
+				if i++; i%8 == 0 {
+					s.Store(benchStats{A: i, H: i})
+				} else if x := s.Load(); x.A != x.H {
+					b.Fatalf("torn read: %v", x)
+				}
+			}
+		})
+	})
+	b.Run("Value", func(b *testing.B) {
+		var s store.Value
+		s.Store(benchStats{})
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			var i int64
+			for pb.Next() {
+				if i++; i%8 == 0 {
+					s.Store(benchStats{A: i, H: i})
+				} else if x := s.Load().(benchStats); x.A != x.H {
+					b.Fatalf("torn read: %v", x)
+				}
+			}
+		})
+	})
+}
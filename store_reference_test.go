@@ -6,8 +6,6 @@ import (
 	"unsafe"
 )
 
-type any = interface{}
-
 type ifaceWords struct {
 	typ  unsafe.Pointer
 	data unsafe.Pointer
@@ -27,7 +25,23 @@ func newFactor(f func(name string, e iface)) {
 		name string
 	}{
 		{iface: &store.Entry{}, name: "store"},
+		{iface: &store.TypedEntry[any]{}, name: "TypedEntry"},
+		{iface: &store.VersionedEntry{}, name: "VersionedEntry"},
 	} {
 		f(v.name, v.iface)
 	}
 }
+
+// newValueFactor runs f against every same-type store,
+// newValue returns a fresh empty one on each call.
+func newValueFactor(f func(name string, newValue func() iface)) {
+	for _, v := range []struct {
+		newValue func() iface
+		name     string
+	}{
+		{newValue: func() iface { return &store.Value{} }, name: "Value"},
+		{newValue: func() iface { return &store.TypedValue[any]{} }, name: "TypedValue"},
+	} {
+		f(v.name, v.newValue)
+	}
+}
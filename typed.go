@@ -0,0 +1,293 @@
+package store
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A TypedEntry provides an atomic load and store of a value of type T.
+// The zero value for a TypedEntry returns the zero value of T from Load.
+//
+// When T is an interface type, values of different concrete types
+// and nil may be stored, as with Entry.
+type TypedEntry[T any] struct {
+	p unsafe.Pointer // *T
+}
+
+func ptr2val[T any](p unsafe.Pointer) (val T) {
+	if p == nil {
+		return
+	}
+	return *(*T)(p)
+}
+
+// Load returns the value set by the most recent Store.
+// It returns the zero value of T if there has been no call to Store.
+func (e *TypedEntry[T]) Load() (val T) {
+	return ptr2val[T](atomic.LoadPointer(&e.p))
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// the zero value, has been stored since the TypedEntry was created
+// or Reset.
+func (e *TypedEntry[T]) LoadOk() (val T, ok bool) {
+	p := atomic.LoadPointer(&e.p)
+	return ptr2val[T](p), p != nil
+}
+
+// Reset returns the TypedEntry to the state where nothing has been stored.
+func (e *TypedEntry[T]) Reset() {
+	atomic.StorePointer(&e.p, nil)
+}
+
+// Store sets the value of the TypedEntry to val.
+func (e *TypedEntry[T]) Store(val T) {
+	atomic.StorePointer(&e.p, unsafe.Pointer(&val))
+}
+
+// Swap stores new into TypedEntry and returns the previous value.
+// It returns the zero value of T if the TypedEntry is empty.
+func (e *TypedEntry[T]) Swap(new T) (old T) {
+	return ptr2val[T](atomic.SwapPointer(&e.p, unsafe.Pointer(&new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for the TypedEntry.
+// Values are compared as interfaces, so CompareAndSwap of an uncomparable
+// value panics with ErrUncomparable.
+func (e *TypedEntry[T]) CompareAndSwap(old, new T) (swapped bool) {
+	swapped, err := e.TryCompareAndSwap(old, new)
+	if err != nil {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwap is like CompareAndSwap but returns ErrUncomparable
+// instead of panicking.
+func (e *TypedEntry[T]) TryCompareAndSwap(old, new T) (swapped bool, err error) {
+	p := atomic.LoadPointer(&e.p)
+	if eq, err := equal(ptr2val[T](p), old); !eq {
+		return false, err
+	}
+	return atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&new)), nil
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns, retrying with the fresh value
+// whenever another writer got there first.
+//
+// It returns the stored value and true, or the last value fn was
+// called with and false if fn declined.
+func (e *TypedEntry[T]) Update(fn func(old T) (new T, ok bool)) (new T, updated bool) {
+	return retry(Retry{}, func() (T, bool, bool) {
+		p := atomic.LoadPointer(&e.p)
+		old := ptr2val[T](p)
+		new, ok := fn(old)
+		if !ok {
+			return old, false, true
+		}
+		if !atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&new)) {
+			return old, false, false
+		}
+		return new, true, true
+	})
+}
+
+// A TypedValue provides an atomic load and store of a value of type T.
+// The zero value for a TypedValue returns the zero value of T from Load.
+//
+// When T is an interface type, all non-nil values stored in a given
+// TypedValue must have the same concrete type, as with Value.
+// Storing an inconsistent type panics; nil may always be stored.
+type TypedValue[T any] struct {
+	p unsafe.Pointer // *typedCell[T]
+}
+
+// typedCell holds a value of a TypedValue. Every write publishes a new
+// cell with a single compare-and-swap, so that the concrete type only
+// changes along with the value and a Reset.
+type typedCell[T any] struct {
+	val T
+	typ unsafe.Pointer // of the non-nil values stored since Reset, interface T only
+}
+
+// isInterface reports whether T is an interface type.
+func isInterface[T any]() bool {
+	var zero T
+	return any(zero) == nil
+}
+
+// typeOf returns the concrete type word of x, nil for a nil interface.
+func typeOf(x any) unsafe.Pointer {
+	return (*ifaceWords)(unsafe.Pointer(&x)).typ
+}
+
+func (v *TypedValue[T]) load() (p unsafe.Pointer, c *typedCell[T]) {
+	p = atomic.LoadPointer(&v.p)
+	return p, (*typedCell[T])(p)
+}
+
+// next returns the cell to replace c, possibly nil, with to store val,
+// or ErrInconsistentType if val has another concrete type than the
+// values c was stored after.
+func (c *typedCell[T]) next(val T) (*typedCell[T], error) {
+	next := &typedCell[T]{val: val}
+	if c != nil {
+		next.typ = c.typ
+	}
+	if isInterface[T]() {
+		switch typ := typeOf(val); {
+		case typ == nil || typ == next.typ:
+		case next.typ != nil:
+			return nil, ErrInconsistentType
+		default:
+			next.typ = typ
+		}
+	}
+	return next, nil
+}
+
+// publish replaces p, holding c, with a cell holding val. It fails if
+// p is no longer the current cell.
+func (v *TypedValue[T]) publish(p unsafe.Pointer, c *typedCell[T], val T) (bool, error) {
+	next, err := c.next(val)
+	if err != nil {
+		return false, err
+	}
+	return atomic.CompareAndSwapPointer(&v.p, p, unsafe.Pointer(next)), nil
+}
+
+// Load returns the value set by the most recent Store.
+// It returns the zero value of T if there has been no call to Store.
+func (v *TypedValue[T]) Load() (val T) {
+	val, _ = v.LoadOk()
+	return val
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// the zero value, has been stored since the TypedValue was created
+// or Reset.
+func (v *TypedValue[T]) LoadOk() (val T, ok bool) {
+	if _, c := v.load(); c != nil {
+		return c.val, true
+	}
+	return val, false
+}
+
+// Reset returns the TypedValue to the state where nothing has been
+// stored, after which it accepts a value of a new concrete type.
+func (v *TypedValue[T]) Reset() {
+	atomic.StorePointer(&v.p, nil)
+}
+
+// Store sets the value of the TypedValue to val.
+// Store of an inconsistent concrete type panics with ErrInconsistentType.
+func (v *TypedValue[T]) Store(val T) {
+	if err := v.TryStore(val); err != nil {
+		panic(err)
+	}
+}
+
+// TryStore is like Store but returns ErrInconsistentType
+// instead of panicking.
+func (v *TypedValue[T]) TryStore(val T) error {
+	_, err := v.TrySwap(val)
+	return err
+}
+
+// Swap stores new into TypedValue and returns the previous value.
+// It returns the zero value of T if the TypedValue is empty.
+// Swap of an inconsistent concrete type panics with ErrInconsistentType.
+func (v *TypedValue[T]) Swap(new T) (old T) {
+	old, err := v.TrySwap(new)
+	if err != nil {
+		panic(err)
+	}
+	return old
+}
+
+// TrySwap is like Swap but returns ErrInconsistentType
+// instead of panicking.
+func (v *TypedValue[T]) TrySwap(new T) (old T, err error) {
+	for {
+		p, c := v.load()
+		ok, err := v.publish(p, c, new)
+		if err != nil {
+			return old, err
+		}
+		if ok {
+			if c != nil {
+				old = c.val
+			}
+			return old, nil
+		}
+	}
+}
+
+// CompareAndSwap executes the compare-and-swap operation for the TypedValue.
+// CompareAndSwap of an inconsistent concrete type panics with
+// ErrInconsistentType, and of an uncomparable value with ErrUncomparable.
+func (v *TypedValue[T]) CompareAndSwap(old, new T) (swapped bool) {
+	swapped, err := v.TryCompareAndSwap(old, new)
+	if err != nil {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwap is like CompareAndSwap but returns ErrInconsistentType
+// or ErrUncomparable instead of panicking.
+func (v *TypedValue[T]) TryCompareAndSwap(old, new T) (swapped bool, err error) {
+	if isInterface[T]() {
+		ot, nt := typeOf(old), typeOf(new)
+		if ot != nil && nt != nil && ot != nt {
+			return false, ErrInconsistentType
+		}
+	}
+	for {
+		p, c := v.load()
+		next, err := c.next(new)
+		if err != nil {
+			return false, err
+		}
+		var cur T
+		if c != nil {
+			cur = c.val
+		}
+		if eq, err := equal(cur, old); !eq {
+			return false, err
+		}
+		if atomic.CompareAndSwapPointer(&v.p, p, unsafe.Pointer(next)) {
+			return true, nil
+		}
+	}
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns, retrying with the fresh value
+// whenever another writer got there first.
+//
+// It returns the stored value and true, or the last value fn was
+// called with and false if fn declined. A value of an inconsistent
+// concrete type panics with ErrInconsistentType.
+func (v *TypedValue[T]) Update(fn func(old T) (new T, ok bool)) (new T, updated bool) {
+	return retry(Retry{}, func() (T, bool, bool) {
+		p, c := v.load()
+		var old T
+		if c != nil {
+			old = c.val
+		}
+		new, ok := fn(old)
+		if !ok {
+			return old, false, true
+		}
+		swapped, err := v.publish(p, c, new)
+		if err != nil {
+			panic(err)
+		}
+		if !swapped {
+			return old, false, false
+		}
+		return new, true, true
+	})
+}
@@ -0,0 +1,179 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"store"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTypedValue(t *testing.T) {
+	var v store.TypedValue[int]
+	if x := v.Load(); x != 0 {
+		t.Fatal(fmtfn("initial", x, 0))
+	}
+	v.Store(42)
+	if x := v.Load(); x != 42 {
+		t.Fatal(fmtfn("load", x, 42))
+	}
+	if x := v.Swap(84); x != 42 {
+		t.Fatal(fmtfn("swap", x, 42))
+	}
+	if v.CompareAndSwap(42, 1) {
+		t.Fatal("cas should fail, old 42 is stale")
+	}
+	if !v.CompareAndSwap(84, 1) {
+		t.Fatal("cas should succeed, old 84")
+	}
+	if x := v.Load(); x != 1 {
+		t.Fatal(fmtfn("load", x, 1))
+	}
+}
+
+func TestTypedValuePointer(t *testing.T) {
+	var v store.TypedValue[*int]
+	if x := v.Load(); x != nil {
+		t.Fatal(fmtfn("initial", x, nil))
+	}
+	p := new(int)
+	if !v.CompareAndSwap(nil, p) {
+		t.Fatal("cas from initial nil should succeed")
+	}
+	if x := v.Swap(nil); x != p {
+		t.Fatal(fmtfn("swap", x, p))
+	}
+	if x := v.Load(); x != nil {
+		t.Fatal(fmtfn("load", x, nil))
+	}
+}
+
+func TestTypedValueInterface(t *testing.T) {
+	var v store.TypedValue[io.Reader]
+	v.Store(strings.NewReader("foo"))
+	v.Store(nil)
+	if x := v.Load(); x != nil {
+		t.Fatal(fmtfn("load", x, nil))
+	}
+	v.Store(strings.NewReader("bar"))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("store of inconsistent type should panic")
+			}
+		}()
+		v.Store(new(bytes.Buffer))
+	}()
+}
+
+func TestTypedValueTry(t *testing.T) {
+	var v store.TypedValue[io.Reader]
+	if err := v.TryStore(strings.NewReader("foo")); err != nil {
+		t.Fatalf("TryStore: got %v, want nil", err)
+	}
+	if err := v.TryStore(new(bytes.Buffer)); !errors.Is(err, store.ErrInconsistentType) {
+		t.Fatalf("TryStore: got %v, want %v", err, store.ErrInconsistentType)
+	}
+	if _, err := v.TrySwap(new(bytes.Buffer)); !errors.Is(err, store.ErrInconsistentType) {
+		t.Fatalf("TrySwap: got %v, want %v", err, store.ErrInconsistentType)
+	}
+
+	var s store.TypedValue[[]int]
+	s.Store([]int{1})
+	if ok, err := s.TryCompareAndSwap([]int{1}, nil); ok || !errors.Is(err, store.ErrUncomparable) {
+		t.Fatalf("TryCompareAndSwap: got %v %v, want false %v", ok, err, store.ErrUncomparable)
+	}
+}
+
+func TestTypedValueFailedWrite(t *testing.T) {
+	var v store.TypedValue[any]
+	v.Store(nil)
+	if v.CompareAndSwap(0, 1) {
+		t.Fatal("cas of a nil TypedValue matched 0")
+	}
+	v.Update(func(any) (any, bool) { return 1, false })
+	// Neither write fixed the type.
+	if err := v.TryStore("bar"); err != nil {
+		t.Fatalf("TryStore: got %v, want nil", err)
+	}
+}
+
+func TestTypedValueResetRace(t *testing.T) {
+	var v store.TypedValue[io.Reader]
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{strings.NewReader("foo"), new(bytes.Buffer)} {
+		r := r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if v.TryStore(r) == nil {
+					v.TryCompareAndSwap(r, r)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n/10; i++ {
+		v.Reset()
+	}
+	wg.Wait()
+	// Whatever is left, only its type is accepted.
+	var other io.Reader = new(bytes.Buffer)
+	if _, ok := v.Load().(*bytes.Buffer); ok {
+		other = strings.NewReader("bar")
+	}
+	if v.Load() != nil {
+		if err := v.TryStore(other); !errors.Is(err, store.ErrInconsistentType) {
+			t.Fatalf("TryStore of another type than %T: got %v, want %v", v.Load(), err, store.ErrInconsistentType)
+		}
+	}
+}
+
+func TestTypedEntryInterface(t *testing.T) {
+	var e store.TypedEntry[io.Reader]
+	r, b := strings.NewReader("foo"), new(bytes.Buffer)
+	e.Store(r)
+	if x := e.Swap(b); x != r {
+		t.Fatal(fmtfn("swap", x, r))
+	}
+	if !e.CompareAndSwap(b, nil) {
+		t.Fatal("cas to nil should succeed")
+	}
+	if x := e.Load(); x != nil {
+		t.Fatal(fmtfn("load", x, nil))
+	}
+}
+
+func TestTypedEntryConcurrent(t *testing.T) {
+	var e store.TypedEntry[int]
+	var w sync.WaitGroup
+	m, n := 100, 100
+	if testing.Short() {
+		m = 10
+		n = 10
+	}
+	for i := 0; i < m; i++ {
+		w.Add(1)
+		go func() {
+			for j := 0; j < n; j++ {
+				for {
+					old := e.Load()
+					if e.CompareAndSwap(old, old+1) {
+						break
+					}
+				}
+			}
+			w.Done()
+		}()
+	}
+	w.Wait()
+	if x := e.Load(); x != m*n {
+		t.Errorf("did not get to %v, stopped at %v", m*n, x)
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"runtime"
+	"time"
+)
+
+// Updater is an Interface that supports atomic read-modify-write.
+type Updater interface {
+	Interface
+
+	// Update calls fn with the current value and, if fn returns ok,
+	// stores the value it returns, retrying with the fresh value
+	// whenever another writer got there first.
+	//
+	// It returns the stored value and true, or the last value fn was
+	// called with and false if fn declined.
+	Update(fn func(old any) (new any, ok bool)) (new any, updated bool)
+}
+
+// A Backoff waits between two attempts of an update
+// that lost a race, attempt counts from 1.
+type Backoff func(attempt int)
+
+var (
+	// Spin retries immediately.
+	Spin Backoff = func(int) {}
+
+	// Yield lets other goroutines run before retrying.
+	Yield Backoff = func(int) { runtime.Gosched() }
+)
+
+// Exponential returns a Backoff that sleeps base, then twice as long
+// after every failed attempt, up to max.
+func Exponential(base, max time.Duration) Backoff {
+	return func(attempt int) {
+		d := base << uint(attempt-1)
+		if d <= 0 || d > max {
+			d = max
+		}
+		time.Sleep(d)
+	}
+}
+
+// A Retry controls how an update retries on contention.
+// The zero Retry spins without limit.
+type Retry struct {
+	// Backoff is called between attempts, nil means Spin.
+	Backoff Backoff
+
+	// MaxAttempts limits the number of attempts, 0 means no limit.
+	MaxAttempts int
+}
+
+// updater is implemented by stores that can run a single update
+// attempt faster than Load followed by CompareAndSwap.
+type updater interface {
+	tryUpdate(fn func(old any) (new any, ok bool)) (val any, updated, done bool)
+}
+
+// Update is like Updater.Update on v, retrying as r allows.
+// If the attempts run out, Update returns the last value fn was
+// called with and false.
+func (r Retry) Update(v Interface, fn func(old any) (new any, ok bool)) (new any, updated bool) {
+	if u, ok := v.(updater); ok {
+		return retry(r, func() (any, bool, bool) {
+			return u.tryUpdate(fn)
+		})
+	}
+	return retry(r, func() (any, bool, bool) {
+		old := v.Load()
+		new, ok := fn(old)
+		if !ok {
+			return old, false, true
+		}
+		if !v.CompareAndSwap(old, new) {
+			return old, false, false
+		}
+		return new, true, true
+	})
+}
+
+// retry calls attempt until it is done or r gives up.
+func retry[T any](r Retry, attempt func() (val T, updated, done bool)) (val T, updated bool) {
+	for i := 1; ; i++ {
+		val, updated, done := attempt()
+		if done || (r.MaxAttempts > 0 && i >= r.MaxAttempts) {
+			return val, updated
+		}
+		if r.Backoff != nil {
+			r.Backoff(i)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package store_test
+
+import (
+	"store"
+	"sync"
+	"testing"
+	"time"
+)
+
+func incr(old any) (any, bool) {
+	n, _ := old.(int)
+	return n + 1, true
+}
+
+func TestUpdate(t *testing.T) {
+	newFactor(func(name string, v iface) {
+		u := v.(store.Updater)
+		u.Store(nil)
+		if x, ok := u.Update(incr); !ok || x != 1 {
+			t.Fatal(fmtfn(name+" update", x, 1))
+		}
+		if x, ok := u.Update(func(old any) (any, bool) { return nil, false }); ok || x != 1 {
+			t.Fatal(fmtfn(name+" declined update", x, 1))
+		}
+		u.Store([]int{1})
+		x, _ := u.Update(func(old any) (any, bool) {
+			return append(old.([]int), 2), true
+		})
+		if s := x.([]int); len(s) != 2 {
+			t.Fatal(fmtfn(name+" update uncomparable", s, []int{1, 2}))
+		}
+	})
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	retries := []store.Retry{
+		{},
+		{Backoff: store.Yield},
+		{Backoff: store.Exponential(time.Microsecond, time.Millisecond)},
+	}
+	for _, r := range retries {
+		newFactor(func(name string, v iface) {
+			var w sync.WaitGroup
+			v.Store(0)
+			m, n := 100, 100
+			if testing.Short() {
+				m = 10
+				n = 10
+			}
+			for i := 0; i < m; i++ {
+				w.Add(1)
+				go func() {
+					for j := 0; j < n; j++ {
+						r.Update(v, incr)
+					}
+					w.Done()
+				}()
+			}
+			w.Wait()
+			if stop := v.Load().(int); stop != m*n {
+				t.Errorf("%s did not get to %v, stopped at %v", name, m*n, stop)
+			}
+		})
+	}
+}
+
+func TestValueUpdate(t *testing.T) {
+	newValueFactor(func(name string, newValue func() iface) {
+		v := newValue()
+		var w sync.WaitGroup
+		m, n := 100, 100
+		if testing.Short() {
+			m = 10
+			n = 10
+		}
+		for i := 0; i < m; i++ {
+			w.Add(1)
+			go func() {
+				for j := 0; j < n; j++ {
+					store.Retry{}.Update(v, incr)
+				}
+				w.Done()
+			}()
+		}
+		w.Wait()
+		if stop := v.Load().(int); stop != m*n {
+			t.Errorf("%s did not get to %v, stopped at %v", name, m*n, stop)
+		}
+	})
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var e store.Entry
+	e.Store(0)
+	attempts, waits := 0, 0
+	r := store.Retry{
+		Backoff:     func(int) { waits++ },
+		MaxAttempts: 3,
+	}
+	x, ok := r.Update(&e, func(old any) (any, bool) {
+		attempts++
+		// Interfere so that every attempt loses.
+		e.Store(old.(int) + 10)
+		return old.(int) + 1, true
+	})
+	if ok || attempts != 3 || waits != 2 {
+		t.Fatalf("got %v %v after %d attempts %d waits, want false after 3 attempts 2 waits", x, ok, attempts, waits)
+	}
+	if x != 20 {
+		t.Fatal(fmtfn("last old", x, 20))
+	}
+}
+
+func TestTypedEntryUpdate(t *testing.T) {
+	var e store.TypedEntry[[]string]
+	x, ok := e.Update(func(old []string) ([]string, bool) {
+		return append(old, "foo"), true
+	})
+	if !ok || len(x) != 1 || e.Load()[0] != "foo" {
+		t.Fatal(fmtfn("update", x, []string{"foo"}))
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"runtime"
 	"sync/atomic"
 	"unsafe"
 )
@@ -9,6 +10,16 @@ import (
 // it can store nil value.
 type Value struct {
 	data any
+
+	// resets counts the Resets. Loads retry if it moved while they
+	// read the two words of data, which could then be of two types.
+	resets uint32
+
+	// writers counts the typed writes in progress, which a Reset
+	// waits for before it lets a value of another type in.
+	writers int32
+
+	w unsafe.Pointer // *waiters, set by the first WaitFor
 }
 
 // ifaceWords is interface{} internal representation.
@@ -20,184 +31,328 @@ type ifaceWords struct {
 // wrap nil value in entry
 var empty = unsafe.Pointer(new(any))
 
-// Load returns the Any set by the most recent Store.
-// It returns nil if there has been no call to Store for this Any.
-func (s *Value) Load() (val any) {
+// inProgress marks the type word of a Value whose first store
+// or Reset has not yet completed.
+var inProgress = unsafe.Pointer(&empty)
+
+// nilType is the type word of a Value holding a nil stored before any
+// value of a concrete type, its data word is empty.
+var nilType = typeOf(storedNil{})
+
+type storedNil struct{}
+
+// load returns the words of the current value, a nil typ if none has
+// been stored.
+func (s *Value) load() (typ, data unsafe.Pointer) {
 	vp := (*ifaceWords)(unsafe.Pointer(s))
 	for {
-		typ := atomic.LoadPointer(&vp.typ)
-		if typ == nil || typ == unsafe.Pointer(&empty) {
-			// First store not yet completed.
-			return nil
+		r := atomic.LoadUint32(&s.resets)
+		typ = atomic.LoadPointer(&vp.typ)
+		switch typ {
+		case nil, inProgress:
+			// First store or Reset not yet completed.
+			return nil, nil
+		case nilType:
+			// The data word may already belong to a first store.
+			return nilType, empty
 		}
-		data := atomic.LoadPointer(&vp.data)
-		if data == empty {
-			return nil
+		data = atomic.LoadPointer(&vp.data)
+		if atomic.LoadUint32(&s.resets) == r {
+			return typ, data
 		}
-		// return *(*any)(unsafe.Pointer(&ifaceWords{typ: typ, data: data}))
-		vlp := (*ifaceWords)(unsafe.Pointer(&val))
-		vlp.typ = typ
-		vlp.data = data
-		return
 	}
 }
 
-// Store sets the Any of the Any to x.
-// All calls to Store for a given Any must use Anys of the same concrete type.
-// Store of an inconsistent type panics, as does Store(nil).
-func (s *Value) Store(val any) {
+// Load returns the Any set by the most recent Store.
+// It returns nil if there has been no call to Store for this Any.
+func (s *Value) Load() (val any) {
+	val, _ = s.LoadOk()
+	return val
+}
+
+// loadType returns the concrete type of the stored values,
+// nil if none has been stored yet.
+func (s *Value) loadType() unsafe.Pointer {
+	if typ, _ := s.load(); typ != nilType {
+		return typ
+	}
+	return nil
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// nil, has been stored since the Value was created or Reset.
+func (s *Value) LoadOk() (val any, ok bool) {
+	typ, data := s.load()
+	if typ == nil {
+		return nil, false
+	}
+	return packEface(typ, data), true
+}
+
+// Reset returns the Value to the state where nothing has been stored,
+// after which it accepts a value of a new concrete type. Writes of the
+// old type still in progress complete before Reset does.
+func (s *Value) Reset() {
 	vp := (*ifaceWords)(unsafe.Pointer(s))
-	vlp := (*ifaceWords)(unsafe.Pointer(&val))
 	for {
 		typ := atomic.LoadPointer(&vp.typ)
 		if typ == nil {
-			// Attempt to start first store.
-			// Disable preemption so that other goroutines can use
-			// active spin wait to wait for completion.
-			if val == nil {
-				// not init store nil, return
-				return
-			}
-			runtime_procPin()
-			if !atomic.CompareAndSwapPointer(&vp.typ, nil, unsafe.Pointer(&empty)) {
-				runtime_procUnpin()
-				continue
-			}
-			// Complete first store.
-			atomic.StorePointer(&vp.data, vlp.data)
-			atomic.StorePointer(&vp.typ, vlp.typ)
-			runtime_procUnpin()
 			return
 		}
-		if typ == empty {
+		if typ == inProgress {
 			continue
 		}
-		if val == nil {
-			// wrap nil value
-			vlp.typ = atomic.LoadPointer(&vp.typ)
-			vlp.data = empty
+		// Take the Value through the first store protocol backwards,
+		// so that concurrent first stores wait for it. Preemption
+		// stays enabled: the writes waited for may need this P.
+		if !atomic.CompareAndSwapPointer(&vp.typ, typ, inProgress) {
+			continue
 		}
-		// First store completed. Check type and overwrite data.
-		if typ != vlp.typ {
-			panic("store: store of inconsistently typed value into Value")
+		atomic.AddUint32(&s.resets, 1)
+		for atomic.LoadInt32(&s.writers) != 0 {
+			runtime.Gosched()
 		}
-		atomic.StorePointer(&vp.data, vlp.data)
+		atomic.StorePointer(&vp.data, nil)
+		atomic.StorePointer(&vp.typ, nil)
+		wake(&s.w)
 		return
 	}
 }
 
+// firstStore replaces from, the type word of an empty Value or of one
+// holding a first nil, with the words of val. It reports false if
+// another write got there first.
+func (s *Value) firstStore(from unsafe.Pointer, val any) bool {
+	vp := (*ifaceWords)(unsafe.Pointer(s))
+	vlp := (*ifaceWords)(unsafe.Pointer(&val))
+	typ, data := vlp.typ, vlp.data
+	if val == nil {
+		typ, data = nilType, empty
+	}
+	// Disable preemption so that other goroutines can use
+	// active spin wait to wait for completion; and so that
+	// GC does not see the fake type accidentally.
+	runtime_procPin()
+	if !atomic.CompareAndSwapPointer(&vp.typ, from, inProgress) {
+		runtime_procUnpin()
+		return false
+	}
+	atomic.StorePointer(&vp.data, data)
+	atomic.StorePointer(&vp.typ, typ)
+	runtime_procUnpin()
+	wake(&s.w)
+	return true
+}
+
+// beginWrite registers a write of a value of type typ, which endWrite
+// ends. It reports false, registering nothing, if the type word is no
+// longer typ.
+func (s *Value) beginWrite(typ unsafe.Pointer) bool {
+	atomic.AddInt32(&s.writers, 1)
+	// A Reset that missed the count has changed the type word.
+	if atomic.LoadPointer(&(*ifaceWords)(unsafe.Pointer(s)).typ) == typ {
+		return true
+	}
+	atomic.AddInt32(&s.writers, -1)
+	return false
+}
+
+func (s *Value) endWrite() {
+	atomic.AddInt32(&s.writers, -1)
+}
+
+// Store sets the Any of the Any to x.
+// All calls to Store for a given Any must use Anys of the same concrete type.
+// Store of an inconsistent type panics with ErrInconsistentType.
+func (s *Value) Store(val any) {
+	if err := s.TryStore(val); err != nil {
+		panic(err)
+	}
+}
+
+// TryStore is like Store but returns ErrInconsistentType
+// instead of panicking.
+func (s *Value) TryStore(val any) error {
+	_, err := s.TrySwap(val)
+	return err
+}
+
 // Swap stores new into Any and returns the previous Any. It returns nil if
 // the Any is empty.
 //
 // All calls to Swap for a given Any must use Anys of the same concrete
-// type. Swap of an inconsistent type panics, as does Swap(nil).
+// type. Swap of an inconsistent type panics with ErrInconsistentType.
 func (s *Value) Swap(new any) (old any) {
+	old, err := s.TrySwap(new)
+	if err != nil {
+		panic(err)
+	}
+	return old
+}
+
+// TrySwap is like Swap but returns ErrInconsistentType
+// instead of panicking.
+func (s *Value) TrySwap(new any) (old any, err error) {
 	vp := (*ifaceWords)(unsafe.Pointer(s))
 	np := (*ifaceWords)(unsafe.Pointer(&new))
 	for {
 		typ := atomic.LoadPointer(&vp.typ)
-		if typ == nil {
-			if new == nil {
-				return nil
-			}
-			// Attempt to start first store.
-			// Disable preemption so that other goroutines can use
-			// active spin wait to wait for completion; and so that
-			// GC does not see the fake type accidentally.
-			runtime_procPin()
-			if !atomic.CompareAndSwapPointer(&vp.typ, nil, unsafe.Pointer(^uintptr(0))) {
-				runtime_procUnpin()
-				continue
+		switch {
+		case typ == inProgress:
+			continue
+		case typ == nilType && new == nil:
+			// Already holds nil.
+			wake(&s.w)
+			return nil, nil
+		case typ == nil || typ == nilType:
+			if s.firstStore(typ, new) {
+				return nil, nil
 			}
-			// Complete first store.
-			atomic.StorePointer(&vp.data, np.data)
-			atomic.StorePointer(&vp.typ, np.typ)
-			runtime_procUnpin()
-			return nil
-		}
-		if uintptr(typ) == ^uintptr(0) {
 			continue
 		}
+		data := np.data
 		if new == nil {
 			// wrap nil value
-			np.typ = atomic.LoadPointer(&vp.typ)
-			np.data = empty
-		}
-		// First store completed. Check type and overwrite data.
-		if typ != np.typ {
-			panic("store: swap of inconsistently typed value into Value")
+			data = empty
+		} else if typ != np.typ {
+			return nil, ErrInconsistentType
 		}
-		// Complete first store.
-		data := atomic.SwapPointer(&vp.data, np.data)
-		if data == empty {
-			return nil
+		if !s.beginWrite(typ) {
+			continue
 		}
-		op := (*ifaceWords)(unsafe.Pointer(&old))
-		op.typ, op.data = typ, data
-		return old
+		old = packEface(typ, atomic.SwapPointer(&vp.data, data))
+		s.endWrite()
+		wake(&s.w)
+		return old, nil
 	}
 }
 
 // CompareAndSwap executes the compare-and-swap operation for the Any.
 //
 // All calls to CompareAndSwap for a given Any must use Anys of the same
-// concrete type. CompareAndSwap of an inconsistent type panics, as does
-// CompareAndSwap(old, nil).
+// concrete type. CompareAndSwap of an inconsistent type panics with
+// ErrInconsistentType, and of an uncomparable type with ErrUncomparable.
 func (s *Value) CompareAndSwap(old, new any) (swapped bool) {
+	swapped, err := s.TryCompareAndSwap(old, new)
+	if err != nil {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwap is like CompareAndSwap but returns ErrInconsistentType
+// or ErrUncomparable instead of panicking.
+func (s *Value) TryCompareAndSwap(old, new any) (swapped bool, err error) {
 	vp := (*ifaceWords)(unsafe.Pointer(s))
 	op := (*ifaceWords)(unsafe.Pointer(&old))
 	np := (*ifaceWords)(unsafe.Pointer(&new))
-	if new == nil {
-		// wrap nil value
-		np.typ = atomic.LoadPointer(&vp.typ)
-		np.data = empty
-	}
-	if op.typ != nil && np.typ != op.typ {
-		panic("store: compare and swap of inconsistently typed values")
+	if old != nil && new != nil && np.typ != op.typ {
+		return false, ErrInconsistentType
 	}
 	for {
 		typ := atomic.LoadPointer(&vp.typ)
-		if typ == nil {
+		switch {
+		case typ == inProgress:
+			continue
+		case typ == nil || typ == nilType:
+			// The current value is nil.
 			if old != nil {
-				return false
+				return false, nil
 			}
-			if new == nil {
-				// typ == old == new == nil
-				return true
+			if typ == nilType && new == nil {
+				wake(&s.w)
+				return true, nil
 			}
-			// Attempt to start first store.
-			// Disable preemption so that other goroutines can use
-			// active spin wait to wait for completion; and so that
-			// GC does not see the fake type accidentally.
-			runtime_procPin()
-			if !atomic.CompareAndSwapPointer(&vp.typ, nil, unsafe.Pointer(^uintptr(0))) {
-				runtime_procUnpin()
-				continue
+			if s.firstStore(typ, new) {
+				return true, nil
 			}
-			// Complete first store.
-			atomic.StorePointer(&vp.data, np.data)
-			atomic.StorePointer(&vp.typ, np.typ)
-			runtime_procUnpin()
-			return true
-		}
-		if uintptr(typ) == ^uintptr(0) {
 			continue
 		}
 		// First store completed. Check type and overwrite data.
-		if typ != np.typ {
-			panic("store: compare and swap of inconsistently typed value into Value")
+		ndata := np.data
+		if new == nil {
+			// wrap nil value
+			ndata = empty
+		} else if typ != np.typ {
+			return false, ErrInconsistentType
+		}
+		if !s.beginWrite(typ) {
+			continue
 		}
-
 		data := atomic.LoadPointer(&vp.data)
-		var i = *(*any)(unsafe.Pointer(&ifaceWords{typ: typ, data: data}))
-		// var i any
-		// (*ifaceWords)(unsafe.Pointer(&i)).typ = typ
-		// (*ifaceWords)(unsafe.Pointer(&i)).data = data
-		if i != old {
-			return false
+		eq, err := equal(packEface(typ, data), old)
+		swapped = eq && atomic.CompareAndSwapPointer(&vp.data, data, ndata)
+		s.endWrite()
+		if !swapped {
+			return false, err
+		}
+		wake(&s.w)
+		return true, nil
+	}
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns, retrying with the fresh value
+// whenever another writer got there first.
+//
+// It returns the stored value and true, or the last value fn was
+// called with and false if fn declined. Use Retry to back off or
+// bound the number of attempts. A value of an inconsistent type
+// panics with ErrInconsistentType.
+func (s *Value) Update(fn func(old any) (new any, ok bool)) (new any, updated bool) {
+	return Retry{}.Update(s, fn)
+}
+
+func (s *Value) tryUpdate(fn func(old any) (new any, ok bool)) (val any, updated, done bool) {
+	vp := (*ifaceWords)(unsafe.Pointer(s))
+	typ, data := s.load()
+	if typ == nil || typ == nilType {
+		// No concrete type yet, let CompareAndSwap start it.
+		new, ok := fn(nil)
+		if !ok {
+			return nil, false, true
+		}
+		if !s.CompareAndSwap(nil, new) {
+			return nil, false, false
 		}
-		return atomic.CompareAndSwapPointer(&vp.data, data, np.data)
+		return new, true, true
 	}
+	old := packEface(typ, data)
+	new, ok := fn(old)
+	if !ok {
+		return old, false, true
+	}
+	np := (*ifaceWords)(unsafe.Pointer(&new))
+	ndata := np.data
+	if new == nil {
+		// wrap nil value
+		ndata = empty
+	} else if typ != np.typ {
+		panic(ErrInconsistentType)
+	}
+	// fn ran without registering, a Reset may have come in between.
+	if !s.beginWrite(typ) {
+		return old, false, false
+	}
+	swapped := atomic.CompareAndSwapPointer(&vp.data, data, ndata)
+	s.endWrite()
+	if !swapped {
+		return old, false, false
+	}
+	wake(&s.w)
+	return new, true, true
+}
+
+// packEface returns the interface{} made of typ and data,
+// unwrapping the nil value.
+func packEface(typ, data unsafe.Pointer) (val any) {
+	if data == empty {
+		return nil
+	}
+	vlp := (*ifaceWords)(unsafe.Pointer(&val))
+	vlp.typ = typ
+	vlp.data = data
+	return
 }
 
 // Disable/enable preemption, implemented in runtime.
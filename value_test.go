@@ -5,6 +5,7 @@ package store_test
 // license that can be found in the LICENSE file.
 
 import (
+	"errors"
 	"math/rand"
 	"runtime"
 	"store"
@@ -80,13 +81,13 @@ func TestValueLarge(t *testing.T) {
 }
 
 func TestValuePanic(t *testing.T) {
-	const badErr = "store: store of inconsistently typed value into Value"
+	badErr := store.ErrInconsistentType
 	var v store.Value
 	v.Store(42)
 	func() {
 		defer func() {
-			err := recover()
-			if err != badErr {
+			err, _ := recover().(error)
+			if !errors.Is(err, badErr) {
 				t.Fatalf("inconsistent store panic: got '%v', want '%v'", err, badErr)
 			}
 		}()
@@ -94,6 +95,34 @@ func TestValuePanic(t *testing.T) {
 	}()
 }
 
+func TestValueTry(t *testing.T) {
+	var v store.Value
+	if err := v.TryStore(42); err != nil {
+		t.Fatalf("TryStore: got %v, want nil", err)
+	}
+	if err := v.TryStore("foo"); !errors.Is(err, store.ErrInconsistentType) {
+		t.Fatalf("TryStore: got %v, want %v", err, store.ErrInconsistentType)
+	}
+	if old, err := v.TrySwap("foo"); old != nil || !errors.Is(err, store.ErrInconsistentType) {
+		t.Fatalf("TrySwap: got %v %v, want nil %v", old, err, store.ErrInconsistentType)
+	}
+	if old, err := v.TrySwap(84); old != 42 || err != nil {
+		t.Fatalf("TrySwap: got %v %v, want 42 nil", old, err)
+	}
+	if ok, err := v.TryCompareAndSwap(84, "foo"); ok || !errors.Is(err, store.ErrInconsistentType) {
+		t.Fatalf("TryCompareAndSwap: got %v %v, want false %v", ok, err, store.ErrInconsistentType)
+	}
+	if ok, err := v.TryCompareAndSwap(84, 1); !ok || err != nil {
+		t.Fatalf("TryCompareAndSwap: got %v %v, want true nil", ok, err)
+	}
+
+	var s store.Value
+	s.Store([]int{1})
+	if ok, err := s.TryCompareAndSwap([]int{1}, []int{2}); ok || !errors.Is(err, store.ErrUncomparable) {
+		t.Fatalf("TryCompareAndSwap: got %v %v, want false %v", ok, err, store.ErrUncomparable)
+	}
+}
+
 func TestValueConcurrent(t *testing.T) {
 	tests := [][]any{
 		{uint16(0), ^uint16(0), uint16(1 + 2<<8), uint16(3 + 4<<8)},
@@ -156,39 +185,43 @@ var Value_ValueSwapTests = []struct {
 	init any
 	new  any
 	want any
-	err  any
+	err  error
 }{
 	{init: nil, new: nil, want: nil, err: nil},
 	{init: nil, new: true, want: nil, err: nil},
-	{init: true, new: "", err: "store: swap of inconsistently typed value into Value"},
+	{init: true, new: "", err: store.ErrInconsistentType},
 	{init: true, new: false, want: true, err: nil},
 	{init: true, new: nil, want: true, err: nil},
 }
 
 func TestValue_Swap(t *testing.T) {
-	for i, tt := range Value_ValueSwapTests {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			var v store.Value
-			if tt.init != nil {
-				v.Store(tt.init)
-			}
-			defer func() {
-				err := recover()
-				switch {
-				case tt.err == nil && err != nil:
-					t.Errorf("should not panic, got %v", err)
-				case tt.err != nil && err == nil:
-					t.Errorf("should panic %v, got <nil>", tt.err)
+	newValueFactor(func(name string, newValue func() iface) {
+		for i, tt := range Value_ValueSwapTests {
+			t.Run(name+strconv.Itoa(i), func(t *testing.T) {
+				v := newValue()
+				if tt.init != nil {
+					v.Store(tt.init)
 				}
-			}()
-			if got := v.Swap(tt.new); got != tt.want {
-				t.Errorf("got %v, want %v", got, tt.want)
-			}
-			if got := v.Load(); got != tt.new {
-				t.Errorf("got %v, want %v", got, tt.new)
-			}
-		})
-	}
+				defer func() {
+					err := recover()
+					switch {
+					case tt.err == nil && err != nil:
+						t.Errorf("should not panic, got %v", err)
+					case tt.err != nil && err == nil:
+						t.Errorf("should panic %v, got <nil>", tt.err)
+					case tt.err != nil && err != tt.err:
+						t.Errorf("should panic %v, got %v", tt.err, err)
+					}
+				}()
+				if got := v.Swap(tt.new); got != tt.want {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				if got := v.Load(); got != tt.new {
+					t.Errorf("got %v, want %v", got, tt.new)
+				}
+			})
+		}
+	})
 }
 
 func TestValueSwapConcurrent(t *testing.T) {
@@ -225,13 +258,13 @@ var Value_CompareAndSwapTests = []struct {
 	new  any
 	old  any
 	want bool
-	err  any
+	err  error
 }{
 	{init: nil, new: nil, old: nil, want: true, err: nil},
-	{init: nil, new: true, old: "", err: "store: compare and swap of inconsistently typed values into Value"},
+	{init: nil, new: true, old: "", err: store.ErrInconsistentType},
 	{init: nil, new: true, old: true, want: false, err: nil},
 	{init: nil, new: true, old: nil, want: true, err: nil},
-	{init: true, new: "", err: "store: compare and swap of inconsistently typed value into Value"},
+	{init: true, new: "", err: store.ErrInconsistentType},
 	{init: true, new: true, old: false, want: false, err: nil},
 	{init: true, new: true, old: true, want: true, err: nil},
 	{init: true, new: nil, old: true, want: true, err: nil},
@@ -240,26 +273,30 @@ var Value_CompareAndSwapTests = []struct {
 }
 
 func TestValue_CompareAndSwap(t *testing.T) {
-	for i, tt := range Value_CompareAndSwapTests {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			var v store.Value
-			if tt.init != nil {
-				v.Store(tt.init)
-			}
-			defer func() {
-				err := recover()
-				switch {
-				case tt.err == nil && err != nil:
-					t.Errorf("got %v, wanted no panic", err)
-				case tt.err != nil && err == nil:
-					t.Errorf("did not panic, want %v", tt.err)
+	newValueFactor(func(name string, newValue func() iface) {
+		for i, tt := range Value_CompareAndSwapTests {
+			t.Run(name+strconv.Itoa(i), func(t *testing.T) {
+				v := newValue()
+				if tt.init != nil {
+					v.Store(tt.init)
 				}
-			}()
-			if got := v.CompareAndSwap(tt.old, tt.new); got != tt.want {
-				t.Errorf("got %v, want %v", got, tt.want)
-			}
-		})
-	}
+				defer func() {
+					err := recover()
+					switch {
+					case tt.err == nil && err != nil:
+						t.Errorf("got %v, wanted no panic", err)
+					case tt.err != nil && err == nil:
+						t.Errorf("did not panic, want %v", tt.err)
+					case tt.err != nil && err != tt.err:
+						t.Errorf("panic %v, want %v", err, tt.err)
+					}
+				}()
+				if got := v.CompareAndSwap(tt.old, tt.new); got != tt.want {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
 }
 
 func TestValueCompareAndSwapConcurrent(t *testing.T) {
@@ -288,3 +325,93 @@ func TestValueCompareAndSwapConcurrent(t *testing.T) {
 		t.Errorf("did not get to %v, stopped at %v", m*n, stop)
 	}
 }
+
+func TestValueCompareAndSwapNil(t *testing.T) {
+	var v store.Value
+	v.Store(true)
+	v.Store(nil)
+	if v.CompareAndSwap(false, true) {
+		t.Fatal("cas of stored nil matched false")
+	}
+	if !v.CompareAndSwap(nil, true) {
+		t.Fatal("cas of stored nil did not match nil")
+	}
+}
+
+func TestValueLoadOkReset(t *testing.T) {
+	newValueFactor(func(name string, newValue func() iface) {
+		v := newValue()
+		if x, ok := v.LoadOk(); x != nil || ok {
+			t.Fatalf("%s initial LoadOk: got %v %v, want nil false", name, x, ok)
+		}
+		v.Store(nil)
+		if x, ok := v.LoadOk(); x != nil || !ok {
+			t.Fatalf("%s LoadOk after first Store(nil): got %v %v, want nil true", name, x, ok)
+		}
+		// The first nil does not fix the type.
+		v.Store(42)
+		v.Store(nil)
+		if x, ok := v.LoadOk(); x != nil || !ok {
+			t.Fatalf("%s LoadOk after Store(nil): got %v %v, want nil true", name, x, ok)
+		}
+		v.Reset()
+		if x, ok := v.LoadOk(); x != nil || ok {
+			t.Fatalf("%s LoadOk after Reset: got %v %v, want nil false", name, x, ok)
+		}
+		// A reset Value accepts a new concrete type.
+		v.Store("foo")
+		if x, ok := v.LoadOk(); x != "foo" || !ok {
+			t.Fatalf("%s LoadOk: got %v %v, want foo true", name, x, ok)
+		}
+		v.Reset()
+		if old := v.Swap(nil); old != nil {
+			t.Fatalf("%s Swap(nil) after Reset: got %v, want nil", name, old)
+		}
+		if x, ok := v.LoadOk(); x != nil || !ok {
+			t.Fatalf("%s LoadOk after Swap(nil): got %v %v, want nil true", name, x, ok)
+		}
+		v.Reset()
+		if !v.CompareAndSwap(nil, nil) {
+			t.Fatalf("%s CompareAndSwap(nil, nil) after Reset failed", name)
+		}
+		if x, ok := v.LoadOk(); x != nil || !ok {
+			t.Fatalf("%s LoadOk after CompareAndSwap(nil, nil): got %v %v, want nil true", name, x, ok)
+		}
+	})
+}
+
+func TestValueResetRace(t *testing.T) {
+	var v store.Value
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	var wg sync.WaitGroup
+	for _, val := range []any{1, "foo", 2.5} {
+		val := val
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if v.TryStore(val) == nil {
+					v.TryCompareAndSwap(val, val)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				// A value made of the words of two types would
+				// not be one of those stored.
+				if x := v.Load(); x != nil && x != 1 && x != "foo" && x != 2.5 {
+					t.Errorf("Load: got %v", x)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < n/10; i++ {
+		v.Reset()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A VersionedEntry is an Entry that pairs every stored value with a
+// version, incremented by each successful write. Comparing versions
+// detects any intervening write, even one that stores an equal value.
+// The zero value for a VersionedEntry returns nil at version 0.
+type VersionedEntry struct {
+	p unsafe.Pointer // *versioned
+}
+
+type versioned struct {
+	val   any
+	ver   uint64
+	unset bool // written by Reset
+}
+
+func (e *VersionedEntry) load() (p unsafe.Pointer, val any, ver uint64) {
+	p = atomic.LoadPointer(&e.p)
+	if p == nil {
+		return nil, nil, 0
+	}
+	v := (*versioned)(p)
+	return p, v.val, v.ver
+}
+
+// publish replaces p, the version ver, with val at the next version.
+func (e *VersionedEntry) publish(p unsafe.Pointer, ver uint64, val any) bool {
+	return atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&versioned{val: val, ver: ver + 1}))
+}
+
+// Load returns the value set by the most recent Store.
+func (e *VersionedEntry) Load() (val any) {
+	_, val, _ = e.load()
+	return val
+}
+
+// LoadVersion returns the value set by the most recent Store and its version.
+func (e *VersionedEntry) LoadVersion() (val any, ver uint64) {
+	_, val, ver = e.load()
+	return val, ver
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// nil, has been stored since the VersionedEntry was created or Reset.
+func (e *VersionedEntry) LoadOk() (val any, ok bool) {
+	p := atomic.LoadPointer(&e.p)
+	if p == nil {
+		return nil, false
+	}
+	v := (*versioned)(p)
+	return v.val, !v.unset
+}
+
+// Reset returns the VersionedEntry to the state where nothing has
+// been stored. Reset is a write: it moves to the next version.
+func (e *VersionedEntry) Reset() {
+	for {
+		p, _, ver := e.load()
+		next := &versioned{ver: ver + 1, unset: true}
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(next)) {
+			return
+		}
+	}
+}
+
+// Store sets the value of the VersionedEntry to val.
+func (e *VersionedEntry) Store(val any) {
+	e.Swap(val)
+}
+
+// Swap stores new into VersionedEntry and returns the previous value.
+// It returns nil if the VersionedEntry is empty.
+func (e *VersionedEntry) Swap(new any) (old any) {
+	for {
+		p, old, ver := e.load()
+		if e.publish(p, ver, new) {
+			return old
+		}
+	}
+}
+
+// CompareAndSwap executes the compare-and-swap operation for the
+// VersionedEntry, comparing values.
+// CompareAndSwap of an uncomparable value panics with ErrUncomparable.
+func (e *VersionedEntry) CompareAndSwap(old, new any) (swapped bool) {
+	p, cur, ver := e.load()
+	eq, err := equal(cur, old)
+	if err != nil {
+		panic(err)
+	}
+	return eq && e.publish(p, ver, new)
+}
+
+// CompareAndSwapVersion stores new if the version is still ver,
+// as returned by LoadVersion.
+func (e *VersionedEntry) CompareAndSwapVersion(ver uint64, new any) (swapped bool) {
+	p, _, cur := e.load()
+	return cur == ver && e.publish(p, ver, new)
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns, retrying with the fresh value
+// whenever another writer got there first.
+//
+// It returns the stored value and true, or the last value fn was
+// called with and false if fn declined.
+func (e *VersionedEntry) Update(fn func(old any) (new any, ok bool)) (new any, updated bool) {
+	return Retry{}.Update(e, fn)
+}
+
+func (e *VersionedEntry) tryUpdate(fn func(old any) (new any, ok bool)) (val any, updated, done bool) {
+	p, old, ver := e.load()
+	new, ok := fn(old)
+	if !ok {
+		return old, false, true
+	}
+	if !e.publish(p, ver, new) {
+		return old, false, false
+	}
+	return new, true, true
+}
@@ -0,0 +1,63 @@
+package store_test
+
+import (
+	"store"
+	"sync"
+	"testing"
+)
+
+func TestVersionedEntry(t *testing.T) {
+	var e store.VersionedEntry
+	if x, ver := e.LoadVersion(); x != nil || ver != 0 {
+		t.Fatalf("initial: got %v %v, want nil 0", x, ver)
+	}
+	e.Store(1)
+	x, ver := e.LoadVersion()
+	if x != 1 || ver != 1 {
+		t.Fatalf("load: got %v %v, want 1 1", x, ver)
+	}
+	// An equal value written in between still bumps the version.
+	e.Store(1)
+	if e.CompareAndSwapVersion(ver, 2) {
+		t.Fatal("cas of stale version should fail")
+	}
+	x, ver = e.LoadVersion()
+	if x != 1 || ver != 2 {
+		t.Fatalf("load: got %v %v, want 1 2", x, ver)
+	}
+	if !e.CompareAndSwapVersion(ver, nil) {
+		t.Fatal("cas of current version should succeed")
+	}
+	if x, ver = e.LoadVersion(); x != nil || ver != 3 {
+		t.Fatalf("load: got %v %v, want nil 3", x, ver)
+	}
+}
+
+func TestVersionedEntryConcurrent(t *testing.T) {
+	var e store.VersionedEntry
+	var w sync.WaitGroup
+	m, n := 100, 100
+	if testing.Short() {
+		m = 10
+		n = 10
+	}
+	for i := 0; i < m; i++ {
+		w.Add(1)
+		go func() {
+			for j := 0; j < n; j++ {
+				for {
+					x, ver := e.LoadVersion()
+					c, _ := x.(int)
+					if e.CompareAndSwapVersion(ver, c+1) {
+						break
+					}
+				}
+			}
+			w.Done()
+		}()
+	}
+	w.Wait()
+	if x, ver := e.LoadVersion(); x != m*n || ver != uint64(m*n) {
+		t.Errorf("did not get to %v, stopped at %v version %v", m*n, x, ver)
+	}
+}
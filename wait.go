@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// waiters parks the goroutines waiting for a write to one store. It is
+// allocated by the first of them and kept as long as the store, so
+// that writes to a store nobody waits for only pay for an atomic load.
+type waiters struct {
+	n   int32 // len(chs)
+	mu  sync.Mutex
+	chs map[chan struct{}]struct{}
+}
+
+// waitersAt returns the waiters *p points to, allocating them.
+func waitersAt(p *unsafe.Pointer) *waiters {
+	if w := atomic.LoadPointer(p); w != nil {
+		return (*waiters)(w)
+	}
+	w := &waiters{chs: map[chan struct{}]struct{}{}}
+	if atomic.CompareAndSwapPointer(p, nil, unsafe.Pointer(w)) {
+		return w
+	}
+	return (*waiters)(atomic.LoadPointer(p))
+}
+
+// wake signals the channels waiting on the store whose waiters *p
+// points to, after a write to it.
+func wake(p *unsafe.Pointer) {
+	w := (*waiters)(atomic.LoadPointer(p))
+	if w == nil || atomic.LoadInt32(&w.n) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.chs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add makes the next writes signal ch, which should have a buffer of 1.
+// A write that misses it is seen by a load made after add returns.
+func (w *waiters) add(ch chan struct{}) {
+	w.mu.Lock()
+	w.chs[ch] = struct{}{}
+	atomic.StoreInt32(&w.n, int32(len(w.chs)))
+	w.mu.Unlock()
+}
+
+func (w *waiters) remove(ch chan struct{}) {
+	w.mu.Lock()
+	delete(w.chs, ch)
+	atomic.StoreInt32(&w.n, int32(len(w.chs)))
+	w.mu.Unlock()
+}
+
+// waitFor implements WaitFor for the store read with load, whose
+// waiters *p points to.
+func waitFor(ctx context.Context, p *unsafe.Pointer, load func() any, pred func(val any) bool) (val any, err error) {
+	w := waitersAt(p)
+	ch := make(chan struct{}, 1)
+	w.add(ch)
+	defer w.remove(ch)
+	for {
+		if val = load(); pred(val) {
+			return val, nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WaitFor blocks until the current value satisfies pred and returns
+// it, or returns ctx.Err() once ctx is done. pred is called with the
+// current value, then again after each write only.
+func (s *Value) WaitFor(ctx context.Context, pred func(val any) bool) (val any, err error) {
+	return waitFor(ctx, &s.w, s.Load, pred)
+}
+
+// WaitFor blocks until the current value satisfies pred and returns
+// it, or returns ctx.Err() once ctx is done. pred is called with the
+// current value, then again after each write only, CompareAndSwapN
+// and transactions included.
+func (e *Entry) WaitFor(ctx context.Context, pred func(val any) bool) (val any, err error) {
+	return waitFor(ctx, &e.w, e.Load, pred)
+}
@@ -0,0 +1,77 @@
+package store_test
+
+import (
+	"context"
+	"store"
+	"testing"
+	"time"
+)
+
+func testWaitFor(t *testing.T, name string, v interface {
+	store.Interface
+	WaitFor(ctx context.Context, pred func(val any) bool) (any, error)
+}, write func(i int)) {
+	done := make(chan any)
+	go func() {
+		val, err := v.WaitFor(context.Background(), func(val any) bool {
+			return val != nil && val.(int) >= 3
+		})
+		if err != nil {
+			t.Errorf("%s: WaitFor: got %v, want nil", name, err)
+		}
+		done <- val
+	}()
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond)
+		write(i)
+	}
+	if x := <-done; x == nil || x.(int) < 3 {
+		t.Fatalf("%s: WaitFor returned %v not ready", name, x)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := v.WaitFor(ctx, func(any) bool { return false }); err != context.DeadlineExceeded {
+		t.Fatalf("%s: WaitFor: got %v, want %v", name, err, context.DeadlineExceeded)
+	}
+}
+
+func TestValueWaitFor(t *testing.T) {
+	var v store.Value
+	testWaitFor(t, "Store", &v, func(i int) { v.Store(i) })
+	v.Reset()
+	testWaitFor(t, "CompareAndSwap", &v, func(i int) {
+		if i == 0 {
+			v.CompareAndSwap(nil, i)
+		} else {
+			v.CompareAndSwap(i-1, i)
+		}
+	})
+	v.Reset()
+	testWaitFor(t, "Update", &v, func(i int) { v.Update(func(any) (any, bool) { return i, true }) })
+}
+
+func TestEntryWaitFor(t *testing.T) {
+	var e store.Entry
+	testWaitFor(t, "Store", &e, func(i int) { e.Store(i) })
+	e.Reset()
+	testWaitFor(t, "CompareAndSwapN", &e, func(i int) {
+		store.CompareAndSwapN(store.CASOp{Entry: &e, Old: e.Load(), New: i})
+	})
+	e.Reset()
+	testWaitFor(t, "Atomically", &e, func(i int) {
+		store.Atomically(func(tx *store.Tx) error {
+			tx.Store(&e, i)
+			return nil
+		})
+	})
+}
+
+func TestWatchedWaitFor(t *testing.T) {
+	var v store.Value
+	w := store.NewWatched(&v)
+	// Writes made directly to the wrapped Value wake it too.
+	testWaitFor(t, "Value", w, func(i int) { v.Store(i) })
+	w = store.NewWatched(store.NewHistory(1))
+	testWaitFor(t, "History", w, func(i int) { w.Store(i) })
+}
@@ -0,0 +1,96 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A record is the length of its payload, the CRC-32C of its sequence
+// number and payload, the sequence number and the payload.
+const recordHeader = 4 + 4 + 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func appendRecord(buf []byte, seq uint64, payload []byte) []byte {
+	var h [recordHeader]byte
+	binary.BigEndian.PutUint32(h[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint64(h[8:], seq)
+	crc := crc32.Update(0, crcTable, h[8:])
+	binary.BigEndian.PutUint32(h[4:], crc32.Update(crc, crcTable, payload))
+	return append(append(buf, h[:]...), payload...)
+}
+
+// scanRecords calls fn for every intact record of data in order, until
+// fn returns false. It returns the size of the intact prefix of data,
+// which is len(data) unless the tail is torn or corrupt.
+func scanRecords(data []byte, fn func(seq uint64, payload []byte) bool) (good int) {
+	for len(data)-good >= recordHeader {
+		h := data[good : good+recordHeader]
+		n := int(binary.BigEndian.Uint32(h[0:]))
+		if n > len(data)-good-recordHeader {
+			break
+		}
+		payload := data[good+recordHeader : good+recordHeader+n]
+		crc := crc32.Update(0, crcTable, h[8:])
+		if binary.BigEndian.Uint32(h[4:]) != crc32.Update(crc, crcTable, payload) {
+			break
+		}
+		good += recordHeader + n
+		if !fn(binary.BigEndian.Uint64(h[8:]), payload) {
+			return len(data)
+		}
+	}
+	return good
+}
+
+// A segment file holds the records from its first sequence number on,
+// and is named after it.
+const segmentSuffix = ".log"
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%016x%s", first, segmentSuffix)
+}
+
+// listSegments returns the first sequence numbers of the segments in
+// dir, in order.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var firsts []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 16, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+	return firsts, nil
+}
+
+func (l *Log) segmentPath(first uint64) string {
+	return filepath.Join(l.dir, segmentName(first))
+}
+
+// syncDir makes the creation of a segment in dir durable, as
+// durable.Value does for its renames.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
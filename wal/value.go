@@ -0,0 +1,176 @@
+package wal
+
+import (
+	"errors"
+	"store"
+	"sync"
+)
+
+// A Value is a store.Value or a store.Entry of its own whose writes
+// are appended to a Log, so that the log holds its whole history.
+// Load stays lock-free, writes are serialized.
+//
+// The store is only reachable through the Value, so that no write
+// escapes the log. A write is applied to it first and appended once
+// it succeeded: a write the store rejects, such as one of another type
+// for a store.Value, is not logged, and one that fails to be logged is
+// rolled back, though Loads may see it meanwhile. The Try methods
+// return the error, the others panic with it.
+//
+// A write whose record was appended but whose snapshot failed took
+// effect: the Try methods return its results along with the
+// SnapshotError, the others do not panic.
+//
+// The Log of a Value should only be appended to by it, or its records
+// no longer tell the values the Value held.
+type Value struct {
+	log   *Log
+	v     ownStore
+	mu    sync.Mutex // serializes writes
+	typed bool       // a non-nil value was stored since Reset, guarded by mu
+}
+
+// ownStore is the store a Value owns, a store.Value or a store.Entry.
+type ownStore interface {
+	store.Interface
+	TryCompareAndSwap(old, new any) (swapped bool, err error)
+}
+
+// trySwapper is implemented by store.Value, not by store.Entry whose
+// Swap cannot fail.
+type trySwapper interface {
+	TrySwap(new any) (old any, err error)
+}
+
+// NewValue returns a Value over a store.Value, holding the last value
+// logged, empty if there is none or it is Unset.
+func (l *Log) NewValue() *Value {
+	return l.newValue(&store.Value{})
+}
+
+// NewEntry returns a Value over a store.Entry, holding the last value
+// logged, empty if there is none or it is Unset.
+func (l *Log) NewEntry() *Value {
+	return l.newValue(&store.Entry{})
+}
+
+func (l *Log) newValue(s ownStore) *Value {
+	v := &Value{log: l, v: s}
+	if seq, val := l.Last(); seq > 0 && val != Unset {
+		s.Store(val)
+		v.typed = val != nil
+	}
+	return v
+}
+
+// Load returns the value set by the most recent write.
+func (v *Value) Load() (val any) {
+	return v.v.Load()
+}
+
+// LoadOk is like Load but also reports whether a value has been stored.
+func (v *Value) LoadOk() (val any, ok bool) {
+	return v.v.LoadOk()
+}
+
+// Store sets the value to val and logs it.
+func (v *Value) Store(val any) {
+	if err := v.TryStore(val); failed(err) {
+		panic(err)
+	}
+}
+
+// TryStore is like Store but returns the error instead of panicking.
+func (v *Value) TryStore(val any) error {
+	_, err := v.TrySwap(val)
+	return err
+}
+
+// Swap sets the value to new, logs it and returns the previous one.
+func (v *Value) Swap(new any) (old any) {
+	old, err := v.TrySwap(new)
+	if failed(err) {
+		panic(err)
+	}
+	return old
+}
+
+// TrySwap is like Swap but returns the error instead of panicking.
+func (v *Value) TrySwap(new any) (old any, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	old, ok := v.v.LoadOk()
+	if s, isTry := v.v.(trySwapper); isTry {
+		if _, err := s.TrySwap(new); err != nil {
+			return nil, err
+		}
+	} else {
+		v.v.Swap(new)
+	}
+	err = v.logged(new, old, ok)
+	if failed(err) {
+		return nil, err
+	}
+	return old, err
+}
+
+// CompareAndSwap sets the value to new and logs it if the value is
+// equal to old.
+func (v *Value) CompareAndSwap(old, new any) (swapped bool) {
+	swapped, err := v.TryCompareAndSwap(old, new)
+	if failed(err) {
+		panic(err)
+	}
+	return swapped
+}
+
+// TryCompareAndSwap is like CompareAndSwap but returns the error
+// instead of panicking.
+func (v *Value) TryCompareAndSwap(old, new any) (swapped bool, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cur, ok := v.v.LoadOk()
+	if swapped, err := v.v.TryCompareAndSwap(old, new); !swapped {
+		return false, err
+	}
+	err = v.logged(new, cur, ok)
+	return !failed(err), err
+}
+
+// Reset logs Unset and returns the store to the state where nothing
+// has been stored.
+func (v *Value) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Resetting cannot fail, logging it first spares a rollback.
+	if _, err := v.log.Append(Unset); failed(err) {
+		panic(err)
+	}
+	v.v.Reset()
+	v.typed = false
+}
+
+// logged appends val, just stored over old, to the log. If it cannot,
+// it puts old back, ok telling whether it was stored, and returns
+// the error.
+func (v *Value) logged(val, old any, ok bool) error {
+	_, err := v.log.Append(val)
+	if failed(err) {
+		if !v.typed {
+			// The write may have fixed the type of a store.Value.
+			v.v.Reset()
+		}
+		if ok {
+			v.v.Store(old)
+		}
+		return err
+	}
+	v.typed = v.typed || val != nil
+	return err
+}
+
+// failed reports whether err means a write did not take effect.
+func failed(err error) bool {
+	var s *SnapshotError
+	return err != nil && !errors.As(err, &s)
+}
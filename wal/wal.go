@@ -0,0 +1,467 @@
+// Package wal keeps every value written to a Value, a store.Value or
+// store.Entry of its own, in a write-ahead log, for auditing and replay.
+//
+// The log is a directory of segment files, each a sequence of
+// CRC-checked records holding one value. Records are numbered from 1.
+// A snapshot of the latest value is taken every SnapshotEvery records,
+// after which segments older than both the snapshot and the Retain
+// most recent records are removed.
+//
+// On Open, a torn or corrupt record at the end of the last segment,
+// as left by a crash in the middle of a write, is cut off.
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"store"
+	"store/durable"
+	"sync"
+)
+
+var (
+	// ErrCorrupt is returned by Open when a record other than the last
+	// ones fails its CRC check, or sequence numbers do not follow.
+	ErrCorrupt = errors.New("wal: corrupt log")
+
+	// ErrNotFound is returned by ValueAt for a sequence number not
+	// yet written.
+	ErrNotFound = errors.New("wal: no such record")
+
+	// ErrCompacted is returned by ValueAt for a record removed by
+	// compaction.
+	ErrCompacted = errors.New("wal: record compacted")
+
+	// ErrClosed is returned when appending to a closed Log.
+	ErrClosed = errors.New("wal: log closed")
+)
+
+// A SnapshotError is returned by Append when the snapshot taken after
+// a record fails. The record was appended all the same, and the
+// snapshot is tried again SnapshotEvery records later.
+type SnapshotError struct {
+	Err error
+}
+
+func (e *SnapshotError) Error() string {
+	return "wal: snapshot: " + e.Err.Error()
+}
+
+func (e *SnapshotError) Unwrap() error {
+	return e.Err
+}
+
+// Unset is the value of the records logged by Value.Reset, and of no
+// others: Replay, ValueAt and Last return it so that a Reset can be
+// told from a stored nil. Append(Unset) logs a Reset.
+var Unset any = unset{}
+
+type unset struct{}
+
+// Options configure a Log. The zero Options are usable.
+type Options struct {
+	// Codec encodes the values, nil means durable.Gob.
+	Codec durable.Codec
+
+	// SegmentSize is the size past which a new segment is started,
+	// 0 means 4 MiB.
+	SegmentSize int64
+
+	// SnapshotEvery is the number of records between snapshots,
+	// 0 means 1024.
+	SnapshotEvery uint64
+
+	// Retain is the number of most recent records kept by compaction,
+	// 0 means keeping every record.
+	Retain uint64
+
+	// NoSync skips syncing each record to disk, trading durability of
+	// the last writes for speed.
+	NoSync bool
+}
+
+// A Log is a write-ahead log of values. It is safe for concurrent use.
+type Log struct {
+	dir  string
+	opts Options
+	snap *durable.Value // *snapshot
+
+	mu       sync.Mutex // guards the fields below and appends
+	segments []uint64   // first sequence number of each segment
+	f        *os.File   // the last segment, nil once closed
+	size     int64      // of f
+	last     uint64     // sequence number of the last record
+	lastVal  any
+	hasLast  bool
+
+	files sync.RWMutex // held for reading segments, and to remove them
+}
+
+// snapshot is the value of the record seq.
+type snapshot struct {
+	Seq   uint64
+	Val   store.Entry
+	Unset bool // the record is a Reset
+}
+
+func init() {
+	store.RegisterType("wal.snapshot", (*snapshot)(nil))
+}
+
+func (s *snapshot) value() any {
+	if s.Unset {
+		return Unset
+	}
+	return s.Val.Load()
+}
+
+// Open opens the log in dir, creating it if needed, and recovers from
+// a write cut short by a crash.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.Codec == nil {
+		opts.Codec = durable.Gob
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 4 << 20
+	}
+	if opts.SnapshotEvery == 0 {
+		opts.SnapshotEvery = 1024
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, opts: opts}
+	var err error
+	if l.snap, err = durable.Open(filepath.Join(dir, "snapshot"), opts.Codec); err != nil {
+		return nil, err
+	}
+	if s, _ := l.snap.Load().(*snapshot); s != nil {
+		l.last, l.lastVal, l.hasLast = s.Seq, s.value(), true
+	}
+	if l.segments, err = listSegments(dir); err != nil {
+		return nil, err
+	}
+	if err := l.recover(); err != nil {
+		return nil, err
+	}
+	if len(l.segments) == 0 {
+		l.segments = []uint64{l.last + 1}
+	}
+	path := l.segmentPath(l.segments[len(l.segments)-1])
+	if l.f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	fi, err := l.f.Stat()
+	if err == nil {
+		// The segment may just have been created.
+		err = syncDir(dir)
+	}
+	if err != nil {
+		l.f.Close()
+		return nil, err
+	}
+	l.size = fi.Size()
+	return l, nil
+}
+
+// recover checks the segments, truncating a torn tail of the last one,
+// and finds the last record.
+func (l *Log) recover() error {
+	var lastPayload []byte
+	var expect uint64 // first record of the next segment
+	for i, first := range l.segments {
+		if i > 0 && first != expect {
+			return ErrCorrupt
+		}
+		path := l.segmentPath(first)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		next, ok := first, true
+		good := scanRecords(data, func(seq uint64, payload []byte) bool {
+			if seq != next {
+				ok = false
+				return false
+			}
+			next++
+			lastPayload = payload
+			return true
+		})
+		switch {
+		case !ok:
+			return ErrCorrupt
+		case good < len(data) && i < len(l.segments)-1:
+			return ErrCorrupt
+		case good < len(data):
+			if err := os.Truncate(path, int64(good)); err != nil {
+				return err
+			}
+		}
+		if next > first {
+			l.last = next - 1
+		}
+		expect = next
+	}
+	if lastPayload != nil {
+		val, err := l.decode(lastPayload)
+		if err != nil {
+			return err
+		}
+		l.lastVal, l.hasLast = val, true
+	}
+	return nil
+}
+
+// Append adds val to the log and returns its sequence number. If the
+// snapshot that may follow fails, a SnapshotError is returned along
+// with the sequence number of the record, which was appended.
+func (l *Log) Append(val any) (seq uint64, err error) {
+	payload, err := l.encode(val)
+	if err != nil {
+		return 0, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, ErrClosed
+	}
+	seq = l.last + 1
+	rec := appendRecord(nil, seq, payload)
+	if l.size > 0 && l.size+int64(len(rec)) > l.opts.SegmentSize {
+		if err := l.rotate(seq); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := l.f.Write(rec); err != nil {
+		// Drop what part of the record made it.
+		l.f.Truncate(l.size)
+		return 0, err
+	}
+	if !l.opts.NoSync {
+		if err := l.f.Sync(); err != nil {
+			l.f.Truncate(l.size)
+			return 0, err
+		}
+	}
+	l.size += int64(len(rec))
+	l.last, l.lastVal, l.hasLast = seq, val, true
+	if seq%l.opts.SnapshotEvery == 0 {
+		if err := l.snapshot(); err != nil {
+			return seq, &SnapshotError{err}
+		}
+	}
+	return seq, nil
+}
+
+// A record's payload is its kind, then the encoded value for a
+// recordValue.
+const (
+	recordValue byte = iota
+	recordUnset
+)
+
+func (l *Log) encode(val any) ([]byte, error) {
+	if val == Unset {
+		return []byte{recordUnset}, nil
+	}
+	data, err := l.opts.Codec.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{recordValue}, data...), nil
+}
+
+func (l *Log) decode(payload []byte) (any, error) {
+	switch {
+	case len(payload) == 0:
+		return nil, ErrCorrupt
+	case payload[0] == recordUnset:
+		return Unset, nil
+	case payload[0] != recordValue:
+		return nil, ErrCorrupt
+	}
+	return l.opts.Codec.Unmarshal(payload[1:])
+}
+
+// rotate starts a new segment with the record first.
+func (l *Log) rotate(first uint64) error {
+	f, err := os.OpenFile(l.segmentPath(first), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// Without the directory entry, the records synced to f could
+	// be lost with it.
+	if err := syncDir(l.dir); err != nil {
+		f.Close()
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	l.f.Close()
+	l.f, l.size = f, 0
+	l.segments = append(l.segments, first)
+	return nil
+}
+
+// Snapshot records the latest value in a snapshot and compacts the
+// log. Append takes snapshots every SnapshotEvery records.
+func (l *Log) Snapshot() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshot()
+}
+
+func (l *Log) snapshot() error {
+	if !l.hasLast {
+		return nil
+	}
+	s := &snapshot{Seq: l.last, Unset: l.lastVal == Unset}
+	if !s.Unset {
+		s.Val.Store(l.lastVal)
+	}
+	if err := l.snap.Store(s); err != nil {
+		return err
+	}
+	return l.compact(s.Seq)
+}
+
+// compact removes the segments whose records are all older than both
+// the snapshot at seq and the Retain most recent records.
+func (l *Log) compact(seq uint64) error {
+	if l.opts.Retain == 0 {
+		return nil
+	}
+	if l.last < l.opts.Retain {
+		return nil
+	}
+	if keep := l.last - l.opts.Retain + 1; keep < seq {
+		seq = keep
+	}
+	// Segment i ends where segment i+1 starts, the last one is kept.
+	n := 0
+	for n < len(l.segments)-1 && l.segments[n+1] <= seq {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	// Replays read segments without mu, rather than wait for them
+	// leave it to the next snapshot.
+	if !l.files.TryLock() {
+		return nil
+	}
+	defer l.files.Unlock()
+	for _, first := range l.segments[:n] {
+		if err := os.Remove(l.segmentPath(first)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	l.segments = append([]uint64(nil), l.segments[n:]...)
+	return nil
+}
+
+// Last returns the sequence number of the last record, 0 if there is
+// none, and its value.
+func (l *Log) Last() (seq uint64, val any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last, l.lastVal
+}
+
+// Replay calls fn for every record still in the log in order, until
+// fn returns false. If compaction removed the records before the
+// snapshot, fn is first called with the snapshot.
+func (l *Log) Replay(fn func(seq uint64, val any) bool) error {
+	return l.replay(0, fn)
+}
+
+// ValueAt returns the value of the record seq.
+func (l *Log) ValueAt(seq uint64) (val any, err error) {
+	if seq == 0 {
+		return nil, ErrNotFound
+	}
+	err = ErrNotFound
+	if rerr := l.replay(seq, func(s uint64, v any) bool {
+		if s == seq {
+			val, err = v, nil
+		} else if s > seq {
+			err = ErrCompacted
+		}
+		return s < seq
+	}); rerr != nil {
+		return nil, rerr
+	}
+	return val, err
+}
+
+// replay calls fn from the record from on, or the first one after
+// it, as Replay does.
+func (l *Log) replay(from uint64, fn func(seq uint64, val any) bool) error {
+	l.files.RLock()
+	defer l.files.RUnlock()
+	l.mu.Lock()
+	segments, last := l.segments, l.last
+	l.mu.Unlock()
+
+	s, _ := l.snap.Load().(*snapshot)
+	if s != nil && s.Seq >= from && (len(segments) == 0 || segments[0] > s.Seq) {
+		if !fn(s.Seq, s.value()) {
+			return nil
+		}
+	}
+	i := sort.Search(len(segments), func(i int) bool { return segments[i] > from })
+	if i > 0 {
+		i--
+	}
+	var err error
+	for _, first := range segments[i:] {
+		if first > last {
+			break
+		}
+		data, rerr := os.ReadFile(l.segmentPath(first))
+		if rerr != nil {
+			return rerr
+		}
+		more := true
+		scanRecords(data, func(seq uint64, payload []byte) bool {
+			if seq > last {
+				more = false
+				return false
+			}
+			if seq < from {
+				return true
+			}
+			var val any
+			if val, err = l.decode(payload); err != nil {
+				more = false
+				return false
+			}
+			more = fn(seq, val)
+			return more
+		})
+		if !more {
+			break
+		}
+	}
+	return err
+}
+
+// Close syncs and closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return ErrClosed
+	}
+	err := l.f.Sync()
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
@@ -0,0 +1,350 @@
+package wal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"store"
+	"store/durable"
+	"store/wal"
+	"testing"
+)
+
+func init() {
+	store.RegisterType("[]int", []int(nil))
+}
+
+// open opens the log in dir, failing t on error.
+func open(t *testing.T, dir string, opts wal.Options) *wal.Log {
+	t.Helper()
+	l, err := wal.Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// appendAll appends vals to l, failing t on error.
+func appendAll(t *testing.T, l *wal.Log, vals ...any) {
+	t.Helper()
+	for _, v := range vals {
+		if _, err := l.Append(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// history returns the records Replay reports.
+func history(t *testing.T, l *wal.Log) (seqs []uint64, vals []any) {
+	t.Helper()
+	if err := l.Replay(func(seq uint64, val any) bool {
+		seqs = append(seqs, seq)
+		vals = append(vals, val)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return seqs, vals
+}
+
+func TestLog(t *testing.T) {
+	for name, codec := range map[string]durable.Codec{"json": durable.JSON, "gob": durable.Gob} {
+		dir := t.TempDir()
+		l, err := wal.Open(dir, wal.Options{Codec: codec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range []any{"a", 2, nil, "d"} {
+			if seq, err := l.Append(v); seq != uint64(i+1) || err != nil {
+				t.Fatalf("%s Append(%v): got %v %v, want %v nil", name, v, seq, err, i+1)
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Append(1); err != wal.ErrClosed {
+			t.Fatalf("%s Append after Close: got %v, want %v", name, err, wal.ErrClosed)
+		}
+
+		l, err = wal.Open(dir, wal.Options{Codec: codec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs, vals := history(t, l)
+		if len(seqs) != 4 || seqs[3] != 4 || vals[0] != "a" || vals[1] != 2 || vals[2] != nil || vals[3] != "d" {
+			t.Fatalf("%s replay: got %v %v", name, seqs, vals)
+		}
+		if v, err := l.ValueAt(2); v != 2 || err != nil {
+			t.Fatalf("%s ValueAt(2): got %v %v", name, v, err)
+		}
+		for _, seq := range []uint64{0, 5} {
+			if _, err := l.ValueAt(seq); err != wal.ErrNotFound {
+				t.Fatalf("%s ValueAt(%v): got %v, want %v", name, seq, err, wal.ErrNotFound)
+			}
+		}
+		if seq, err := l.Append("e"); seq != 5 || err != nil {
+			t.Fatalf("%s Append after reopen: got %v %v, want 5 nil", name, seq, err)
+		}
+		l.Close()
+	}
+}
+
+func TestLogCompaction(t *testing.T) {
+	dir := t.TempDir()
+	opts := wal.Options{SegmentSize: 256, SnapshotEvery: 10, Retain: 15, NoSync: true}
+	l, err := wal.Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 200
+	for i := 1; i <= n; i++ {
+		if _, err := l.Append(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(segments) > 10 {
+		t.Fatalf("%d segments left after compaction", len(segments))
+	}
+	seqs, vals := history(t, l)
+	if !sort.SliceIsSorted(seqs, func(i, j int) bool { return seqs[i] < seqs[j] }) || seqs[len(seqs)-1] != n {
+		t.Fatalf("replay after compaction: got %v", seqs)
+	}
+	if seqs[0] > n-15+1 {
+		t.Fatalf("compaction dropped retained records, first is %v", seqs[0])
+	}
+	for i, seq := range seqs {
+		if vals[i] != int(seq) {
+			t.Fatalf("record %v holds %v", seq, vals[i])
+		}
+	}
+	if _, err := l.ValueAt(1); err != wal.ErrCompacted {
+		t.Fatalf("ValueAt(1): got %v, want %v", err, wal.ErrCompacted)
+	}
+	l.Close()
+
+	// Only the snapshot is left once every segment is gone.
+	for _, s := range segments {
+		os.Remove(s)
+	}
+	if l, err = wal.Open(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	seq, val := l.Last()
+	if seq != n || val != n {
+		t.Fatalf("Last from snapshot: got %v %v, want %v %v", seq, val, n, n)
+	}
+	if seqs, _ := history(t, l); len(seqs) != 1 || seqs[0] != n {
+		t.Fatalf("replay of snapshot: got %v", seqs)
+	}
+	if seq, err := l.Append(0); seq != n+1 || err != nil {
+		t.Fatalf("Append after the snapshot: got %v %v, want %v nil", seq, err, n+1)
+	}
+	l.Close()
+}
+
+// TestLogCrash cuts the last record at every byte, as a crash in the
+// middle of a write would, and checks that Open recovers the records
+// before it.
+func TestLogCrash(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{})
+	appendAll(t, l, "one", "two", "three")
+	l.Close()
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	path := segments[len(segments)-1]
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = open(t, dir, wal.Options{})
+	appendAll(t, l, "four")
+	l.Close()
+	withFour, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cut := len(full); cut < len(withFour); cut++ {
+		if err := os.WriteFile(path, withFour[:cut], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		l, err := wal.Open(dir, wal.Options{})
+		if err != nil {
+			t.Fatalf("cut at %d: %v", cut, err)
+		}
+		if seq, val := l.Last(); seq != 3 || val != "three" {
+			t.Fatalf("cut at %d: last is %v %v, want 3 three", cut, seq, val)
+		}
+		if seq, err := l.Append("four"); seq != 4 || err != nil {
+			t.Fatalf("cut at %d: Append got %v %v", cut, seq, err)
+		}
+		l.Close()
+		if data, _ := os.ReadFile(path); len(data) != len(withFour) {
+			t.Fatalf("cut at %d: torn tail was not cut off", cut)
+		}
+	}
+}
+
+func TestLogCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{SegmentSize: 64})
+	appendAll(t, l, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	l.Close()
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(segments) < 2 {
+		t.Fatal("expected several segments")
+	}
+	data, err := os.ReadFile(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(segments[0], data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.Open(dir, wal.Options{}); !errors.Is(err, wal.ErrCorrupt) {
+		t.Fatalf("got %v, want %v", err, wal.ErrCorrupt)
+	}
+}
+
+func TestValue(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{NoSync: true})
+	v := l.NewValue()
+	v.Store("a")
+	if old := v.Swap("b"); old != "a" {
+		t.Fatalf("Swap: got %v, want a", old)
+	}
+	if v.CompareAndSwap("a", "c") || !v.CompareAndSwap("b", "c") {
+		t.Fatal("CompareAndSwap wrong result")
+	}
+	// A write the Value rejects is neither applied nor logged.
+	if err := v.TryStore(1); err != store.ErrInconsistentType {
+		t.Fatalf("Store of another type: got %v, want %v", err, store.ErrInconsistentType)
+	}
+	if ok, err := v.TryCompareAndSwap("c", 1); ok || err != store.ErrInconsistentType {
+		t.Fatalf("CompareAndSwap to another type: got %v %v, want false %v", ok, err, store.ErrInconsistentType)
+	}
+	if seq, val := l.Last(); seq != 3 || val != "c" || v.Load() != "c" {
+		t.Fatalf("after rejected writes: last is %v %v, value %v, want 3 c c", seq, val, v.Load())
+	}
+	l.Close()
+	if err := v.TryStore("d"); err != wal.ErrClosed {
+		t.Fatalf("Store to closed log: got %v, want %v", err, wal.ErrClosed)
+	}
+	if v.Load() != "c" {
+		t.Fatal("a write that was not logged was not rolled back")
+	}
+
+	l = open(t, dir, wal.Options{})
+	e := l.NewEntry()
+	if e.Load() != "c" {
+		t.Fatalf("NewEntry after reopen: got %v, want c", e.Load())
+	}
+	e.Store([]int{1})
+	if _, err := e.TryCompareAndSwap([]int{1}, "d"); !errors.Is(err, store.ErrUncomparable) {
+		t.Fatalf("uncomparable: got %v", err)
+	}
+	e.Reset()
+	if _, ok := e.LoadOk(); ok {
+		t.Fatal("Reset did not reset the Entry")
+	}
+	if _, vals := history(t, l); len(vals) != 5 || vals[0] != "a" || vals[2] != "c" || vals[4] != wal.Unset {
+		t.Fatalf("history: got %v", vals)
+	}
+	l.Close()
+
+	// A Reset and a stored nil are told apart after a reopen.
+	l = open(t, dir, wal.Options{})
+	v = l.NewValue()
+	if _, ok := v.LoadOk(); ok {
+		t.Fatal("NewValue after a logged Reset: the Value is not empty")
+	}
+	v.Store(nil)
+	l.Close()
+	l = open(t, dir, wal.Options{})
+	if val, ok := l.NewValue().LoadOk(); val != nil || !ok {
+		t.Fatalf("NewValue after a logged nil: got %v %v, want nil true", val, ok)
+	}
+	l.Close()
+}
+
+func TestLogConcurrent(t *testing.T) {
+	l := open(t, t.TempDir(), wal.Options{SegmentSize: 128, SnapshotEvery: 8, Retain: 20, NoSync: true})
+	defer l.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 500; i++ {
+			if _, err := l.Append(i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		last := uint64(0)
+		if err := l.Replay(func(seq uint64, val any) bool {
+			if seq <= last || val != int(seq) {
+				t.Errorf("replay: record %v holds %v after %v", seq, val, last)
+				return false
+			}
+			last = seq
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLogSnapshotUnset(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{})
+	appendAll(t, l, 1, wal.Unset)
+	if err := l.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	for _, s := range segments {
+		if err := os.Remove(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l = open(t, dir, wal.Options{})
+	defer l.Close()
+	if seq, val := l.Last(); seq != 2 || val != wal.Unset {
+		t.Fatalf("Last from snapshot: got %v %v, want 2 Unset", seq, val)
+	}
+}
+
+func TestValueSnapshotError(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{SnapshotEvery: 2, NoSync: true})
+	defer l.Close()
+	// A directory in the way makes the snapshot fail.
+	if err := os.MkdirAll(filepath.Join(dir, "snapshot", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	v := l.NewValue()
+	v.Store(1)
+	var serr *wal.SnapshotError
+	if err := v.TryStore(2); !errors.As(err, &serr) {
+		t.Fatalf("TryStore: got %v, want a SnapshotError", err)
+	}
+	if seq, val := l.Last(); seq != 2 || val != 2 || v.Load() != 2 {
+		t.Fatalf("after a failed snapshot: last is %v %v, value %v, want 2 2 2", seq, val, v.Load())
+	}
+	if ok := v.CompareAndSwap(2, 3); !ok || v.Load() != 3 {
+		t.Fatalf("CompareAndSwap: got %v %v, want true 3", ok, v.Load())
+	}
+	// The write took effect, Store does not panic.
+	v.Store(4)
+}
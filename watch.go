@@ -0,0 +1,283 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"unsafe"
+)
+
+// A Watched wraps a Value or an Entry and notifies subscribers after
+// every successful Store, Swap and CompareAndSwap made through it.
+// Those writes also wake goroutines blocked in WaitFor.
+//
+// Load stays lock-free. Writes are serialized, so that every
+// subscriber sees them in the order they were applied.
+// Writes made directly to the wrapped store are not noticed.
+type Watched struct {
+	v    Interface
+	mu   sync.Mutex
+	subs []*subscriber
+	w    unsafe.Pointer // *waiters, unless v has a WaitFor of its own
+}
+
+// NewWatched returns a Watched over v, an empty Entry if v is nil.
+func NewWatched(v Interface) *Watched {
+	if v == nil {
+		v = &Entry{}
+	}
+	return &Watched{v: v}
+}
+
+// Load returns the value set by the most recent Store.
+func (w *Watched) Load() (val any) {
+	return w.v.Load()
+}
+
+// LoadOk is like Load but also reports whether a value, possibly
+// nil, has been stored.
+func (w *Watched) LoadOk() (val any, ok bool) {
+	return w.v.LoadOk()
+}
+
+// Reset returns the wrapped store to the state where nothing has been
+// stored and notifies subscribers of a change to nil.
+func (w *Watched) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := w.v.Load()
+	w.v.Reset()
+	w.notify(old, nil)
+}
+
+// Store sets the value to val and notifies subscribers.
+func (w *Watched) Store(val any) {
+	w.Swap(val)
+}
+
+// Swap stores new, notifies subscribers and returns the previous value.
+func (w *Watched) Swap(new any) (old any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old = w.v.Swap(new)
+	w.notify(old, new)
+	return old
+}
+
+// CompareAndSwap executes the compare-and-swap operation and
+// notifies subscribers if it swapped.
+func (w *Watched) CompareAndSwap(old, new any) (swapped bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if swapped = w.v.CompareAndSwap(old, new); swapped {
+		w.notify(old, new)
+	}
+	return swapped
+}
+
+// Update calls fn with the current value and, if fn returns ok,
+// stores the value it returns and notifies subscribers.
+//
+// It returns the stored value and true, or the value fn was
+// called with and false if fn declined.
+func (w *Watched) Update(fn func(old any) (new any, ok bool)) (new any, updated bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := w.v.Load()
+	new, ok := fn(old)
+	if !ok {
+		return old, false
+	}
+	w.v.Store(new)
+	w.notify(old, new)
+	return new, true
+}
+
+// Subscribe calls fn after every write, as DefaultBacklog.Subscribe.
+func (w *Watched) Subscribe(fn func(old, new any)) (cancel func()) {
+	return DefaultBacklog.Subscribe(w, fn)
+}
+
+// Watch sends every newly written value on the returned channel,
+// as DefaultBacklog.Watch.
+func (w *Watched) Watch(ctx context.Context) <-chan any {
+	return DefaultBacklog.Watch(ctx, w)
+}
+
+// WaitFor blocks until the current value satisfies pred and returns
+// it, or returns ctx.Err() once ctx is done. pred is called with the
+// current value, then again after each write only.
+//
+// It is the WaitFor of the wrapped store if it has one, such as Value
+// and Entry, which direct writes wake too.
+func (w *Watched) WaitFor(ctx context.Context, pred func(val any) bool) (val any, err error) {
+	if v, ok := w.v.(interface {
+		WaitFor(ctx context.Context, pred func(val any) bool) (any, error)
+	}); ok {
+		return v.WaitFor(ctx, pred)
+	}
+	return waitFor(ctx, &w.w, w.v.Load, pred)
+}
+
+// notify queues the change for every subscriber and wakes
+// waiters, w.mu is held.
+func (w *Watched) notify(old, new any) {
+	for _, s := range w.subs {
+		s.push(change{old: old, new: new})
+	}
+	wake(&w.w)
+}
+
+func (w *Watched) remove(s *subscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, x := range w.subs {
+		if x == s {
+			subs := make([]*subscriber, 0, len(w.subs)-1)
+			w.subs = append(append(subs, w.subs[:i]...), w.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// A Backlog says how many changes are kept for a subscriber that
+// falls behind, and what happens once it is full.
+type Backlog struct {
+	// Size is the number of pending changes kept, at least 1.
+	Size int
+
+	// Coalesce merges the newest change into the last pending one,
+	// from its old to the newest new value, instead of dropping the
+	// oldest pending change.
+	Coalesce bool
+}
+
+// DefaultBacklog keeps up to 64 changes and drops the oldest.
+var DefaultBacklog = Backlog{Size: 64}
+
+// Subscribe calls fn with the previous and the new value after every
+// write to w, from a goroutine of its own, one change at a time and
+// in order. The returned cancel stops further calls, it does not
+// wait for a call in progress.
+func (b Backlog) Subscribe(w *Watched, fn func(old, new any)) (cancel func()) {
+	s := b.subscribe(w, fn)
+	return s.cancel
+}
+
+// Watch sends every newly written value of w on the returned
+// channel, which is closed once ctx is done.
+func (b Backlog) Watch(ctx context.Context, w *Watched) <-chan any {
+	ch := make(chan any)
+	s := b.subscribe(w, func(_, new any) {
+		select {
+		case ch <- new:
+		case <-ctx.Done():
+		}
+	})
+	go func() {
+		<-ctx.Done()
+		s.cancel()
+		<-s.exited
+		close(ch)
+	}()
+	return ch
+}
+
+func (b Backlog) subscribe(w *Watched, fn func(old, new any)) *subscriber {
+	size := b.Size
+	if size < 1 {
+		size = 1
+	}
+	s := &subscriber{
+		w:        w,
+		fn:       fn,
+		size:     size,
+		coalesce: b.Coalesce,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	w.mu.Lock()
+	w.subs = append(w.subs, s)
+	w.mu.Unlock()
+	go s.run()
+	return s
+}
+
+type change struct {
+	old, new any
+}
+
+type subscriber struct {
+	w        *Watched
+	fn       func(old, new any)
+	size     int
+	coalesce bool
+
+	mu      sync.Mutex
+	pending []change
+
+	wake   chan struct{}
+	done   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+}
+
+func (s *subscriber) cancel() {
+	s.once.Do(func() {
+		s.w.remove(s)
+		close(s.done)
+	})
+}
+
+func (s *subscriber) push(c change) {
+	s.mu.Lock()
+	switch {
+	case len(s.pending) < s.size:
+		s.pending = append(s.pending, c)
+	case s.coalesce:
+		s.pending[len(s.pending)-1].new = c.new
+	default:
+		copy(s.pending, s.pending[1:])
+		s.pending[len(s.pending)-1] = c
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pop() (c change, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return c, false
+	}
+	c = s.pending[0]
+	s.pending[0] = change{}
+	s.pending = s.pending[1:]
+	return c, true
+}
+
+func (s *subscriber) run() {
+	defer close(s.exited)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			c, ok := s.pop()
+			if !ok {
+				break
+			}
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.fn(c.old, c.new)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package store_test
+
+import (
+	"context"
+	"store"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchedInterface(t *testing.T) {
+	var _ store.Updater = store.NewWatched(nil)
+	w := store.NewWatched(&store.Value{})
+	w.Store(1)
+	if x := w.Swap(2); x != 1 {
+		t.Fatal(fmtfn("swap", x, 1))
+	}
+	if !w.CompareAndSwap(2, 3) || w.CompareAndSwap(2, 4) {
+		t.Fatal("cas wrong result")
+	}
+	if x, ok := w.Update(incr); !ok || x != 4 {
+		t.Fatal(fmtfn("update", x, 4))
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	w := store.NewWatched(&store.Entry{})
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	got := make(chan [2]any, n)
+	cancel := store.Backlog{Size: n}.Subscribe(w, func(old, new any) {
+		got <- [2]any{old, new}
+	})
+	defer cancel()
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			w.Store(i)
+		} else {
+			w.CompareAndSwap(i-1, i)
+		}
+		w.CompareAndSwap(-1, -1) // fails, no change
+	}
+	var prev any
+	for i := 0; i < n; i++ {
+		c := <-got
+		if c[0] != prev || c[1] != i {
+			t.Fatalf("change %d: got %v, want [%v %v]", i, c, prev, i)
+		}
+		prev = i
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	w := store.NewWatched(nil)
+	var mu sync.Mutex
+	calls := 0
+	cancel := w.Subscribe(func(old, new any) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+	cancel()
+	cancel()
+	w.Store(1)
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 0 {
+		t.Fatalf("got %d calls after cancel, want 0", calls)
+	}
+}
+
+func TestSubscribeBacklog(t *testing.T) {
+	for _, tt := range []struct {
+		backlog store.Backlog
+		want    [][2]any
+	}{
+		{store.Backlog{Size: 2}, [][2]any{{nil, 0}, {2, 3}, {3, 4}}},
+		{store.Backlog{Size: 2, Coalesce: true}, [][2]any{{nil, 0}, {0, 1}, {1, 4}}},
+	} {
+		w := store.NewWatched(nil)
+		block := make(chan struct{})
+		got := make(chan [2]any, 10)
+		cancel := tt.backlog.Subscribe(w, func(old, new any) {
+			got <- [2]any{old, new}
+			<-block
+		})
+		w.Store(0)
+		<-got // the subscriber is now busy with the first change
+		for i := 1; i < 5; i++ {
+			w.Store(i)
+		}
+		close(block)
+		for i, want := range tt.want[1:] {
+			if c := <-got; c != want {
+				t.Errorf("%+v change %d: got %v, want %v", tt.backlog, i+1, c, want)
+			}
+		}
+		cancel()
+	}
+}
+
+func TestWatch(t *testing.T) {
+	w := store.NewWatched(&store.Value{})
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := w.Watch(ctx)
+	go func() {
+		for i := 1; i <= 3; i++ {
+			w.Store(i)
+		}
+	}()
+	for i := 1; i <= 3; i++ {
+		if x := <-ch; x != i {
+			t.Fatal(fmtfn("watch", x, i))
+		}
+	}
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	w := store.NewWatched(&store.Value{})
+	calls := 0
+	ready := func(val any) bool {
+		calls++
+		return val != nil && val.(int) >= 3
+	}
+	done := make(chan any)
+	go func() {
+		val, err := w.WaitFor(context.Background(), ready)
+		if err != nil {
+			t.Errorf("WaitFor: got %v, want nil", err)
+		}
+		done <- val
+	}()
+	for i := 0; i < 5; i++ {
+		w.Store(i)
+	}
+	if x := <-done; x.(int) < 3 {
+		t.Fatalf("WaitFor returned %v not ready", x)
+	}
+	if calls > 6 {
+		t.Fatalf("pred called %d times for 5 writes", calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := w.WaitFor(ctx, func(any) bool { return false }); err != context.DeadlineExceeded {
+		t.Fatalf("WaitFor: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}